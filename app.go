@@ -15,19 +15,64 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dialup-inc/ascii/camera"
 	"github.com/dialup-inc/ascii/term"
 	"github.com/dialup-inc/ascii/ui"
 	"github.com/dialup-inc/ascii/videos"
 	"github.com/dialup-inc/ascii/vpx"
+	"github.com/pion/rtcp"
 	"github.com/pion/stun"
 	"github.com/pion/webrtc/v2"
 )
 
 const defaultSTUNServer = "stun.l.google.com:19302"
 
+const (
+	// typingInterval is the minimum time between typing notifications
+	typingInterval = time.Second
+	// typingTimeout is how long to show the typing indicator after your
+	// partner's last keypress
+	typingTimeout = 3 * time.Second
+
+	// adjustmentsTimeout is how long the image adjustments stay in the
+	// status line after the last change
+	adjustmentsTimeout = 3 * time.Second
+)
+
 type App struct {
 	STUNServer string
 
+	// Room is the name of the room to join. If it's empty, you're matched
+	// with a random partner from the lobby.
+	Room string
+
+	// Interests are used to find a partner with something in common
+	Interests []string
+
+	// Camera is the ID of the camera to capture from
+	Camera int
+	// CameraSource names where video comes from, as in camera.Open. It's
+	// a webcam by default.
+	CameraSource string
+
+	// ColorMode is the range of colors the terminal supports
+	ColorMode term.ColorMode
+	// RenderMode controls how video is drawn
+	RenderMode ui.RenderMode
+	// Dither controls how video is dithered
+	Dither ui.Dither
+	// Ramp is the characters used for brightness in ASCII mode
+	Ramp ui.Ramp
+	// ShapeMatch draws edges with characters that follow their shape
+	ShapeMatch bool
+	// Adjust corrects video before it's drawn
+	Adjust ui.Adjustments
+	// Encoder holds the settings for the video we send
+	Encoder vpx.EncoderConfig
+	// Mouse lets the mouse wheel scroll the chat. It's off by default
+	// because it stops the terminal from selecting text.
+	Mouse bool
+
 	decoder *vpx.Decoder
 
 	signalerURL string
@@ -42,6 +87,14 @@ type App struct {
 
 	conn *Conn
 
+	// typingMu guards lastTypingSent, which is reset when a message is sent
+	typingMu       sync.Mutex
+	lastTypingSent time.Time
+
+	// adjustTimer hides the image adjustments from the status line. It's
+	// only touched by onKey, and made the first time it's needed.
+	adjustTimer *time.Timer
+
 	capture *Capture
 }
 
@@ -55,7 +108,7 @@ func (a *App) run(ctx context.Context) error {
 	a.quit = cancel
 	a.cancelMu.Unlock()
 
-	if err := term.CaptureStdin(a.onKeypress); err != nil {
+	if err := term.CaptureStdin(a.onKey); err != nil {
 		return err
 	}
 
@@ -67,6 +120,17 @@ func (a *App) run(ctx context.Context) error {
 
 	go a.watchWinSize(ctx)
 
+	if a.Mouse {
+		a.renderer.EnableMouse()
+	}
+
+	a.renderer.Dispatch(ui.SetColorModeEvent(a.ColorMode))
+	a.renderer.Dispatch(ui.SetRenderModeEvent(a.RenderMode))
+	a.renderer.Dispatch(ui.SetDitherEvent(a.Dither))
+	a.renderer.Dispatch(ui.SetRampEvent(a.Ramp))
+	a.renderer.Dispatch(ui.SetShapeMatchEvent(a.ShapeMatch))
+	a.renderer.Dispatch(ui.SetAdjustmentsEvent(a.Adjust))
+
 	var introCtx context.Context
 	introCtx, skipIntro := context.WithCancel(ctx)
 
@@ -117,12 +181,19 @@ func (a *App) run(ctx context.Context) error {
 	a.renderer.Dispatch(ui.SetPageEvent(ui.ChatPage))
 
 	// Start up camera
+	if err := a.capture.SetSource(a.CameraSource); err != nil {
+		return err
+	}
+	a.capture.EncoderConfig = a.Encoder
+	a.capture.OnFrame = func(img image.Image) {
+		a.renderer.Dispatch(ui.SelfFrameEvent(img))
+	}
 	for {
 		if err := ctx.Err(); err != nil {
 			return nil
 		}
 
-		err := a.capture.Start(0, 5)
+		err := a.capture.Start(a.Camera, 5)
 		if err == nil {
 			break
 		}
@@ -140,6 +211,8 @@ func (a *App) run(ctx context.Context) error {
 		}
 	}
 
+	defer a.capture.Stop()
+
 	// Attempt to find match
 	var backoff float64
 	for {
@@ -263,7 +336,7 @@ func (a *App) sendMessage() {
 		return
 	}
 
-	msg := a.renderer.GetState().Input
+	msg := a.renderer.GetState().Prompt.Input
 	msg = strings.TrimSpace(msg)
 
 	// Don't send empty messages
@@ -278,7 +351,80 @@ func (a *App) sendMessage() {
 		})
 	} else {
 		a.renderer.Dispatch(ui.SentMessageEvent(msg))
+
+		a.typingMu.Lock()
+		a.lastTypingSent = time.Time{}
+		a.typingMu.Unlock()
+	}
+}
+
+// nextCamera switches capture to the next camera on the system
+func (a *App) nextCamera() {
+	logError := func(err error) {
+		a.renderer.Dispatch(ui.LogEvent{
+			Level: ui.LogLevelError,
+			Text:  fmt.Sprintf("camera error: %v", err),
+		})
+	}
+
+	if !camera.IsWebcam(a.CameraSource) {
+		logError(errors.New("only webcams can be switched"))
+		return
+	}
+
+	devices, err := camera.Devices()
+	if err != nil {
+		logError(err)
+		return
+	}
+	if len(devices) < 2 {
+		a.renderer.Dispatch(ui.LogEvent{
+			Level: ui.LogLevelInfo,
+			Text:  "No other cameras found",
+		})
+		return
 	}
+
+	// Pick the device after the current one, wrapping around
+	current := a.capture.CameraID()
+	next := devices[0]
+	for _, d := range devices {
+		if d.ID > current {
+			next = d
+			break
+		}
+	}
+
+	if err := a.capture.SwitchCamera(next.ID); err != nil {
+		logError(err)
+		return
+	}
+	a.renderer.Dispatch(ui.LogEvent{
+		Level: ui.LogLevelInfo,
+		Text:  fmt.Sprintf("Switched to %s", next.Name),
+	})
+}
+
+// sendTyping lets your partner know you're typing. It's rate limited so it
+// can be called on every keypress.
+func (a *App) sendTyping() {
+	if a.conn == nil || !a.conn.IsConnected() {
+		return
+	}
+	if !a.renderer.GetState().ChatActive {
+		return
+	}
+
+	a.typingMu.Lock()
+	defer a.typingMu.Unlock()
+
+	if time.Since(a.lastTypingSent) < typingInterval {
+		return
+	}
+	if err := a.conn.SendTyping(); err != nil {
+		return
+	}
+	a.lastTypingSent = time.Now()
 }
 
 func (a *App) checkConnection(ctx context.Context) error {
@@ -328,11 +474,25 @@ func (a *App) connect(ctx context.Context) (ui.EndConnReason, error) {
 
 	ended := make(chan ui.EndConnReason)
 
+	// typingTimer hides the typing indicator if our partner stops without
+	// sending anything. It's made the first time they type.
+	var typingMu sync.Mutex
+	var typingTimer *time.Timer
+	stopTypingTimer := func() {
+		typingMu.Lock()
+		defer typingMu.Unlock()
+
+		if typingTimer != nil {
+			typingTimer.Stop()
+		}
+	}
+	defer stopTypingTimer()
+
 	conn, err := NewConn(webrtc.Configuration{
 		ICEServers: []webrtc.ICEServer{
 			{URLs: []string{fmt.Sprintf("stun:%s", a.STUNServer)}},
 		},
-	})
+	}, a.Encoder.Codec)
 	if err != nil {
 		return ui.EndConnSetupError, err
 	}
@@ -342,10 +502,13 @@ func (a *App) connect(ctx context.Context) (ui.EndConnReason, error) {
 		// Turn off callbacks
 		conn.OnBye = func() {}
 		conn.OnMessage = func(string) {}
+		conn.OnTyping = func() {}
 		conn.OnICEConnectionStateChange = func(webrtc.ICEConnectionState) {}
 		conn.OnFrame = func([]byte) {}
 		conn.OnPLI = func() {}
 		conn.OnDataOpen = func() {}
+		conn.OnReceiverReport = func(rtcp.ReceptionReport) {}
+		conn.OnREMB = func(uint64) {}
 
 		// Send Goodbye packet
 		if conn.IsConnected() {
@@ -358,11 +521,31 @@ func (a *App) connect(ctx context.Context) (ui.EndConnReason, error) {
 		ended <- ui.EndConnGone
 	}
 	conn.OnMessage = func(s string) {
+		stopTypingTimer()
 		a.renderer.Dispatch(ui.ReceivedChatEvent(s))
 	}
+	conn.OnTyping = func() {
+		typingMu.Lock()
+		if typingTimer == nil {
+			typingTimer = time.AfterFunc(typingTimeout, func() {
+				a.renderer.Dispatch(ui.PartnerTypingEvent(false))
+			})
+		} else {
+			typingTimer.Reset(typingTimeout)
+		}
+		typingMu.Unlock()
+
+		a.renderer.Dispatch(ui.PartnerTypingEvent(true))
+	}
+	// Candidates are exchanged over the signaling connection until ICE
+	// connects, so it outlives Match.
+	signalCtx, stopSignaling := context.WithCancel(ctx)
+	defer stopSignaling()
+
 	conn.OnICEConnectionStateChange = func(s webrtc.ICEConnectionState) {
 		switch s {
 		case webrtc.ICEConnectionStateConnected:
+			stopSignaling()
 			a.capture.RequestKeyframe()
 			connectTimeout.Stop()
 			a.renderer.Dispatch(ui.ConnStartedEvent{})
@@ -381,33 +564,68 @@ func (a *App) connect(ctx context.Context) (ui.EndConnReason, error) {
 		a.renderer.Dispatch(ui.DataOpenedEvent{})
 	}
 
-	a.capture.SetTrack(conn.SendTrack)
+	// The decoder is made when the first frame arrives, once we know which
+	// codec our partner is sending. A frame can still be decoding when we
+	// hang up, so decMu keeps it from being closed out from under it.
+	var decMu sync.Mutex
+	var dec *vpx.Decoder
+	var decClosed bool
+	defer func() {
+		decMu.Lock()
+		defer decMu.Unlock()
 
-	dec, err := vpx.NewDecoder(320, 240)
-	if err != nil {
-		return ui.EndConnSetupError, err
-	}
+		if dec != nil {
+			dec.Close()
+		}
+		decClosed = true
+	}()
 	conn.OnFrame = func(frame []byte) {
 		frameTimeout.Reset(5 * time.Second)
 		connectTimeout.Stop()
 
+		decMu.Lock()
+		defer decMu.Unlock()
+
+		if decClosed {
+			return
+		}
+		if dec == nil {
+			d, err := vpx.NewDecoder(conn.RecvCodec())
+			if err != nil {
+				return
+			}
+			dec = d
+		}
+
 		img, err := dec.Decode(frame)
 		if err != nil {
 			conn.SendPLI()
 			return
 		}
+		if img == nil {
+			return
+		}
 		a.renderer.Dispatch(ui.FrameEvent(img))
 	}
 	conn.OnPLI = func() {
 		a.capture.RequestKeyframe()
 	}
+	conn.OnReceiverReport = func(r rtcp.ReceptionReport) {
+		a.capture.ReceiverReport(r.FractionLost, r.Jitter)
+	}
+	conn.OnREMB = func(bps uint64) {
+		a.capture.EstimatedBitrate(bps)
+	}
 
 	a.renderer.Dispatch(ui.LogEvent{
 		Level: ui.LogLevelInfo,
 		Text:  "Searching for match...",
 	})
 
-	err = Match(ctx, a.signalerURL, conn.pc)
+	err = Match(signalCtx, a.signalerURL, MatchOptions{
+		Room:      a.Room,
+		Interests: a.Interests,
+	}, conn.pc)
 	if err == errMatchFailed {
 		return ui.EndConnMatchError, nil
 	}
@@ -417,6 +635,14 @@ func (a *App) connect(ctx context.Context) (ui.EndConnReason, error) {
 
 	connectTimeout.Reset(10 * time.Second)
 
+	codec, pt, err := conn.SendCodec()
+	if err != nil {
+		return ui.EndConnSetupError, err
+	}
+	if err := a.capture.SetTrack(conn.SendTrack, codec, pt); err != nil {
+		return ui.EndConnSetupError, err
+	}
+
 	a.renderer.Dispatch(ui.LogEvent{
 		Level: ui.LogLevelInfo,
 		Text:  "Found match. Connecting...",
@@ -441,10 +667,14 @@ func (a *App) connect(ctx context.Context) (ui.EndConnReason, error) {
 	return reason, nil
 }
 
-func (a *App) onKeypress(c rune) {
-	switch c {
-	case 3: // ctrl-c
+// chatPageSize is how many messages PageUp and PageDown scroll by
+const chatPageSize = 3
 
+func (a *App) onKey(k term.Key) {
+	typed := k.Code == term.KeyRune && k.Mod == 0
+
+	switch {
+	case k.IsCtrl('c'):
 		a.renderer.Dispatch(ui.LogEvent{
 			Level: ui.LogLevelInfo,
 			Text:  "Quitting...",
@@ -456,7 +686,7 @@ func (a *App) onKeypress(c rune) {
 		}
 		a.cancelMu.Unlock()
 
-	case 4: // ctrl-d
+	case k.IsCtrl('d'):
 		a.cancelMu.Lock()
 		if a.nextPartner != nil {
 			a.nextPartner()
@@ -466,13 +696,26 @@ func (a *App) onKeypress(c rune) {
 
 		a.renderer.Dispatch(ui.SkipEvent{})
 
-	case 20: // ctrl-t
+	case k.IsCtrl('t'):
 		a.renderer.Dispatch(ui.ToggleHelpEvent{})
 
-	case 127: // backspace
+	case k.IsCtrl('r'):
+		a.renderer.Dispatch(ui.CycleRenderModeEvent{})
+
+	case k.IsCtrl('g'):
+		a.renderer.Dispatch(ui.CycleDitherEvent{})
+
+	case k.IsCtrl('v'):
+		a.renderer.Dispatch(ui.ToggleSelfViewEvent{})
+
+	case k.IsCtrl('o'):
+		go a.nextCamera()
+
+	case k.Code == term.KeyBackspace && k.Mod == 0:
 		a.renderer.Dispatch(ui.BackspaceEvent{})
+		a.sendTyping()
 
-	case '\n', '\r':
+	case k.Code == term.KeyEnter:
 		a.cancelMu.Lock()
 		if a.startChat != nil {
 			a.startChat()
@@ -482,8 +725,9 @@ func (a *App) onKeypress(c rune) {
 
 		a.sendMessage()
 
-	case ' ':
-		a.renderer.Dispatch(ui.KeypressEvent(c))
+	case typed && k.Rune == ' ':
+		a.renderer.Dispatch(ui.KeypressEvent(k.Rune))
+		a.sendTyping()
 
 		a.cancelMu.Lock()
 		if a.skipIntro != nil {
@@ -496,9 +740,58 @@ func (a *App) onKeypress(c rune) {
 		}
 		a.cancelMu.Unlock()
 
+	case typed:
+		a.renderer.Dispatch(ui.KeypressEvent(k.Rune))
+		a.sendTyping()
+
+	case k.Code == term.KeyPageUp:
+		a.renderer.Dispatch(ui.ScrollEvent(chatPageSize))
+	case k.Code == term.KeyPageDown:
+		a.renderer.Dispatch(ui.ScrollEvent(-chatPageSize))
+	case k.Code == term.KeyWheelUp:
+		a.renderer.Dispatch(ui.ScrollEvent(1))
+	case k.Code == term.KeyWheelDown:
+		a.renderer.Dispatch(ui.ScrollEvent(-1))
+
+	case k.Code == term.KeyF2:
+		a.adjust(ui.AdjustBrightnessEvent(-1))
+	case k.Code == term.KeyF3:
+		a.adjust(ui.AdjustBrightnessEvent(1))
+	case k.Code == term.KeyF4:
+		a.adjust(ui.AdjustContrastEvent(-1))
+	case k.Code == term.KeyF5:
+		a.adjust(ui.AdjustContrastEvent(1))
+	case k.Code == term.KeyF6:
+		a.adjust(ui.AdjustGammaEvent(-1))
+	case k.Code == term.KeyF7:
+		a.adjust(ui.AdjustGammaEvent(1))
+	case k.Code == term.KeyF8:
+		a.adjust(ui.ToggleAdjustmentEvent(ui.ToggleEqualize))
+	case k.Code == term.KeyF9:
+		a.adjust(ui.ToggleAdjustmentEvent(ui.ToggleSharpen))
+	// F10 and F11 usually belong to the terminal's menu bar and full screen
+	case k.IsAlt('e'):
+		a.adjust(ui.ToggleAdjustmentEvent(ui.ToggleEdgeEnhance))
+	case k.IsAlt('i'):
+		a.adjust(ui.ToggleAdjustmentEvent(ui.ToggleInvert))
+
 	default:
-		a.renderer.Dispatch(ui.KeypressEvent(c))
+		a.renderer.Dispatch(ui.KeyEvent(k))
+	}
+}
+
+// adjust changes the image adjustments, showing them in the status line
+// for a while
+func (a *App) adjust(e ui.Event) {
+	a.renderer.Dispatch(e)
+
+	if a.adjustTimer == nil {
+		a.adjustTimer = time.AfterFunc(adjustmentsTimeout, func() {
+			a.renderer.Dispatch(ui.HideAdjustmentsEvent{})
+		})
+		return
 	}
+	a.adjustTimer.Reset(adjustmentsTimeout)
 }
 
 func New(signalerURL string) (*App, error) {
@@ -510,6 +803,8 @@ func New(signalerURL string) (*App, error) {
 	a := &App{
 		signalerURL: signalerURL,
 		STUNServer:  defaultSTUNServer,
+		ColorMode:   term.DetectColorMode(),
+		Encoder:     cap.EncoderConfig,
 
 		renderer: ui.NewRenderer(),
 		capture:  cap,
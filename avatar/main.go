@@ -48,8 +48,29 @@ func fetchAvatar(username string) (image.Image, error) {
 }
 
 func main() {
+	var (
+		render = flag.String("render", "ascii", "how to draw the avatar: ascii, halfblock or braille")
+		dither = flag.String("dither", "none", "how to dither the avatar: none, floyd-steinberg, bayer or atkinson")
+		ramp   = flag.String("ramp", "short", "characters for brightness: short, long, blocks or a custom string from dark to bright")
+		shapes = flag.Bool("shapes", false, "draw edges with characters that match their shape")
+	)
 	flag.Parse()
 
+	renderMode, err := ui.ParseRenderMode(*render)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ditherMode, err := ui.ParseDither(*dither)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rampChars, err := ui.ParseRamp(*ramp)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	username := flag.Arg(0)
 
 	img, err := fetchAvatar(username)
@@ -84,7 +105,14 @@ func main() {
 	ansi.Background(color.RGBA{0, 0, 0, 255})
 	ansi.CursorPosition(1, 1)
 
-	imgANSI := ui.Image2ANSI(img, ws.Cols, ws.Rows, aspect, false)
+	opts := ui.RenderOptions{
+		Mode:       renderMode,
+		Dither:     ditherMode,
+		Ramp:       rampChars,
+		ShapeMatch: *shapes,
+		ColorMode:  term.DetectColorMode(),
+	}
+	imgANSI := ui.Image2ANSI(img, ws.Cols, ws.Rows, aspect, opts)
 	os.Stdout.Write(imgANSI)
 
 	ansi.HideCursor()
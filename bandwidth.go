@@ -0,0 +1,230 @@
+package ascii
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+const (
+	// videoClockRate is the RTP timestamp rate for video
+	videoClockRate = 90000
+
+	// reportInterval is how often we tell our partner how their video is
+	// arriving
+	reportInterval = time.Second
+
+	// minBitrate is the lowest the encoder is turned down to, in kbps
+	minBitrate = 30
+	// minFrameRate is the slowest video is sent when bandwidth is short
+	minFrameRate = 1
+)
+
+// receiveStats keeps track of loss and jitter on an incoming RTP stream,
+// as described in RFC 3550 appendix A
+type receiveStats struct {
+	mu sync.Mutex
+
+	started  bool
+	baseSeq  uint16
+	maxSeq   uint16
+	cycles   uint32
+	received uint32
+
+	// The counts at the last report, to find the loss since then
+	expectedPrior uint32
+	receivedPrior uint32
+
+	// jitter is in RTP timestamp units. Arrival times are measured from
+	// start on the same clock.
+	jitter      float64
+	start       time.Time
+	lastTransit uint32
+
+	bytes      int
+	lastReport time.Time
+	// estimate is the REMB we last sent, in bits per second
+	estimate uint64
+}
+
+func (s *receiveStats) update(pkt *rtp.Packet, arrival time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := pkt.SequenceNumber
+	if !s.started {
+		s.start = arrival
+	}
+	// Both clocks wrap at 32 bits like RTP timestamps, so differences
+	// between transit times are right across the wrap
+	ticks := uint32(int64(arrival.Sub(s.start).Seconds() * videoClockRate))
+	transit := ticks - pkt.Timestamp
+
+	if !s.started {
+		s.started = true
+		s.baseSeq = seq
+		s.maxSeq = seq
+		s.lastTransit = transit
+		s.lastReport = arrival
+	}
+
+	// Sequence numbers wrap around, so count the cycles
+	if delta := seq - s.maxSeq; delta != 0 && delta < 1<<15 {
+		if seq < s.maxSeq {
+			s.cycles += 1 << 16
+		}
+		s.maxSeq = seq
+	}
+	s.received++
+	s.bytes += len(pkt.Payload)
+
+	d := float64(int32(transit - s.lastTransit))
+	if d < 0 {
+		d = -d
+	}
+	s.jitter += (d - s.jitter) / 16
+	s.lastTransit = transit
+}
+
+// report summarizes the stream since the last report, for sending to the
+// stream's sender. It returns false if nothing has arrived yet.
+func (s *receiveStats) report(ssrc uint32, now time.Time) (rtcp.ReceptionReport, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		return rtcp.ReceptionReport{}, 0, false
+	}
+
+	extMax := s.cycles + uint32(s.maxSeq)
+	expected := extMax - uint32(s.baseSeq) + 1
+
+	expectedInterval := expected - s.expectedPrior
+	receivedInterval := s.received - s.receivedPrior
+	s.expectedPrior = expected
+	s.receivedPrior = s.received
+
+	var fractionLost uint8
+	var loss float64
+	if expectedInterval > 0 && receivedInterval < expectedInterval {
+		lost := expectedInterval - receivedInterval
+		fractionLost = uint8(lost * 256 / expectedInterval)
+		loss = float64(lost) / float64(expectedInterval)
+	}
+
+	totalLost := int64(expected) - int64(s.received)
+	if totalLost < 0 {
+		totalLost = 0
+	}
+
+	rr := rtcp.ReceptionReport{
+		SSRC:               ssrc,
+		FractionLost:       fractionLost,
+		TotalLost:          uint32(totalLost),
+		LastSequenceNumber: extMax,
+		Jitter:             uint32(s.jitter),
+	}
+
+	// Guess how much our partner can send from how much got through: back
+	// off when packets are lost and leave room to grow when they aren't
+	var received uint64
+	if elapsed := now.Sub(s.lastReport); elapsed > 0 {
+		received = uint64(float64(s.bytes*8) / elapsed.Seconds())
+	}
+	s.bytes = 0
+	s.lastReport = now
+
+	switch {
+	case loss > 0.1:
+		s.estimate = uint64(float64(received) * (1 - loss/2))
+	case loss < 0.02:
+		if grow := received * 3 / 2; grow > s.estimate {
+			s.estimate = grow
+		}
+	default:
+		s.estimate = received
+	}
+	if s.estimate < minBitrate*1000 {
+		s.estimate = minBitrate * 1000
+	}
+
+	return rr, s.estimate, true
+}
+
+// bandwidthEstimator decides how fast to send from our partner's
+// feedback, loosely following the loss-based controller in Google
+// Congestion Control
+type bandwidthEstimator struct {
+	// max is the bitrate we were configured with, in kbps
+	max      int
+	estimate int
+	// remb is our partner's limit in kbps, or 0 if they haven't sent one
+	remb int
+
+	lastJitter time.Duration
+}
+
+func newBandwidthEstimator(max int) bandwidthEstimator {
+	return bandwidthEstimator{max: max, estimate: max}
+}
+
+// onReceiverReport updates the estimate from the loss and jitter our
+// partner saw
+func (b *bandwidthEstimator) onReceiverReport(fractionLost uint8, jitter uint32) {
+	loss := float64(fractionLost) / 256
+	j := time.Duration(jitter) * time.Second / videoClockRate
+
+	// Rising jitter means queues are filling up somewhere along the way,
+	// which comes before loss
+	congested := j > 50*time.Millisecond && j > b.lastJitter*5/4
+	b.lastJitter = j
+
+	switch {
+	case loss > 0.1:
+		b.estimate = int(float64(b.estimate) * (1 - loss/2))
+	case congested:
+		b.estimate = b.estimate * 85 / 100
+	case loss < 0.02:
+		b.estimate = b.estimate*105/100 + 1
+	}
+	b.estimate = b.clamp(b.estimate)
+}
+
+// onREMB records the most our partner says they can receive
+func (b *bandwidthEstimator) onREMB(bps uint64) {
+	b.remb = int(bps / 1000)
+}
+
+// bitrate is the rate to send at, in kbps
+func (b *bandwidthEstimator) bitrate() int {
+	rate := b.estimate
+	if b.remb > 0 && b.remb < rate {
+		rate = b.remb
+	}
+	return b.clamp(rate)
+}
+
+func (b *bandwidthEstimator) clamp(rate int) int {
+	if rate > b.max {
+		rate = b.max
+	}
+	if rate < minBitrate {
+		rate = minBitrate
+	}
+	return rate
+}
+
+// frameRate scales down the frame rate when the bitrate gets low, so each
+// frame keeps enough bits to be recognizable
+func (b *bandwidthEstimator) frameRate(base float32) float32 {
+	rate := base * 2 * float32(b.bitrate()) / float32(b.max)
+	if rate > base {
+		rate = base
+	}
+	if rate < minFrameRate {
+		rate = minFrameRate
+	}
+	return rate
+}
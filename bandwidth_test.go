@@ -0,0 +1,251 @@
+package ascii
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// frameTicks is one frame at 30fps on the video clock
+const frameTicks = videoClockRate / 30
+
+func TestReceiveStatsJitter(t *testing.T) {
+	frame := time.Second / 30
+
+	tests := []struct {
+		name      string
+		timestamp uint32
+		// delay is how late packet i arrives after it was sent
+		delay func(i int) time.Duration
+		want  float64
+	}{
+		{
+			name:  "steady",
+			delay: func(int) time.Duration { return 20 * time.Millisecond },
+			want:  0,
+		},
+		{
+			// Every transit time differs from the last by 10ms, so the
+			// jitter settles at 900 ticks
+			name: "alternating",
+			delay: func(i int) time.Duration {
+				if i%2 == 0 {
+					return 20 * time.Millisecond
+				}
+				return 30 * time.Millisecond
+			},
+			want: 900,
+		},
+		{
+			name:      "timestamp wraps",
+			timestamp: math.MaxUint32 - 10*frameTicks,
+			delay:     func(int) time.Duration { return 20 * time.Millisecond },
+			want:      0,
+		},
+	}
+
+	for _, tt := range tests {
+		var s receiveStats
+		start := time.Now()
+		for i := 0; i < 200; i++ {
+			pkt := &rtp.Packet{Header: rtp.Header{
+				SequenceNumber: uint16(i),
+				Timestamp:      tt.timestamp + uint32(i*frameTicks),
+			}}
+			s.update(pkt, start.Add(time.Duration(i)*frame+tt.delay(i)))
+		}
+
+		// Arrival times are rounded to whole ticks
+		if math.Abs(s.jitter-tt.want) > 2 {
+			t.Errorf("%s: jitter = %.1f, want %.1f", tt.name, s.jitter, tt.want)
+		}
+	}
+}
+
+func TestReceiveStatsReport(t *testing.T) {
+	tests := []struct {
+		name string
+		// lost is every how many packets one goes missing, or 0 for none
+		lost             int
+		wantFractionLost uint8
+		wantEstimate     uint64
+	}{
+		// 800kbps arrived cleanly, so there's room to grow by half
+		{"no loss", 0, 0, 1200000},
+		// A quarter lost: back off by half the loss from what arrived
+		{"heavy loss", 4, 64, 600000 * 7 / 8},
+		// Some loss: stick to what arrived
+		{"light loss", 20, 12, 760000},
+	}
+
+	for _, tt := range tests {
+		var s receiveStats
+		start := time.Now()
+
+		// 100 packets of 1000 bytes over a second, with the sequence
+		// numbers wrapping partway through
+		const firstSeq = math.MaxUint16 - 50
+		var sent int
+		for i := 0; i < 100; i++ {
+			if tt.lost > 0 && i%tt.lost == 1 {
+				continue
+			}
+			pkt := &rtp.Packet{
+				Header: rtp.Header{
+					SequenceNumber: uint16(firstSeq + i),
+					Timestamp:      uint32(i * frameTicks),
+				},
+				Payload: make([]byte, 1000),
+			}
+			s.update(pkt, start.Add(time.Duration(i)*10*time.Millisecond))
+			sent++
+		}
+
+		rr, estimate, ok := s.report(1234, start.Add(time.Second))
+		if !ok {
+			t.Fatalf("%s: no report", tt.name)
+		}
+		if rr.SSRC != 1234 {
+			t.Errorf("%s: report is for SSRC %d", tt.name, rr.SSRC)
+		}
+		if want := uint32(firstSeq + 99); rr.LastSequenceNumber != want {
+			t.Errorf("%s: last sequence number = %d, want %d", tt.name, rr.LastSequenceNumber, want)
+		}
+		if want := uint32(100 - sent); rr.TotalLost != want {
+			t.Errorf("%s: total lost = %d, want %d", tt.name, rr.TotalLost, want)
+		}
+		if rr.FractionLost != tt.wantFractionLost {
+			t.Errorf("%s: fraction lost = %d, want %d", tt.name, rr.FractionLost, tt.wantFractionLost)
+		}
+		if estimate != tt.wantEstimate {
+			t.Errorf("%s: estimate = %d, want %d", tt.name, estimate, tt.wantEstimate)
+		}
+	}
+
+	var s receiveStats
+	if _, _, ok := s.report(1234, time.Now()); ok {
+		t.Error("reported before anything arrived")
+	}
+}
+
+// receiverReport is the loss and jitter from one RTCP receiver report
+type receiverReport struct {
+	fractionLost uint8
+	jitter       uint32
+}
+
+func repeatReport(r receiverReport, n int) []receiverReport {
+	reports := make([]receiverReport, n)
+	for i := range reports {
+		reports[i] = r
+	}
+	return reports
+}
+
+func TestBandwidthEstimator(t *testing.T) {
+	const max = 500
+	// 60ms of jitter, which is enough to count as congestion if it's rising
+	const highJitter = 60 * videoClockRate / 1000
+
+	tests := []struct {
+		name    string
+		reports []receiverReport
+		remb    uint64
+		want    int
+	}{
+		{
+			name: "starts at the max",
+			want: max,
+		},
+		{
+			name:    "heavy loss backs off by half the loss",
+			reports: []receiverReport{{128, 0}},
+			want:    max * 3 / 4,
+		},
+		{
+			name:    "constant loss bottoms out",
+			reports: repeatReport(receiverReport{128, 0}, 50),
+			want:    minBitrate,
+		},
+		{
+			name: "recovers when loss stops",
+			reports: append(
+				repeatReport(receiverReport{128, 0}, 50),
+				repeatReport(receiverReport{0, 0}, 100)...,
+			),
+			want: max,
+		},
+		{
+			name: "light loss holds steady",
+			reports: append(
+				[]receiverReport{{128, 0}},
+				repeatReport(receiverReport{12, 0}, 10)...,
+			),
+			want: max * 3 / 4,
+		},
+		{
+			name:    "rising jitter backs off",
+			reports: []receiverReport{{0, highJitter}},
+			want:    max * 85 / 100,
+		},
+		{
+			name:    "steady jitter doesn't",
+			reports: []receiverReport{{0, highJitter}, {0, highJitter}},
+			want:    (max*85/100)*105/100 + 1,
+		},
+		{
+			name: "REMB caps the rate",
+			remb: 200000,
+			want: 200,
+		},
+		{
+			name: "REMB can't raise the rate",
+			remb: 2000000,
+			want: max,
+		},
+	}
+
+	for _, tt := range tests {
+		b := newBandwidthEstimator(max)
+		for _, r := range tt.reports {
+			b.onReceiverReport(r.fractionLost, r.jitter)
+		}
+		if tt.remb > 0 {
+			b.onREMB(tt.remb)
+		}
+		if got := b.bitrate(); got != tt.want {
+			t.Errorf("%s: bitrate = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBandwidthEstimatorFrameRate(t *testing.T) {
+	const max = 500
+
+	tests := []struct {
+		bitrate int
+		want    float32
+	}{
+		{max, 30},
+		{max / 2, 30},
+		{max / 4, 15},
+		{minBitrate, 30 * 2 * float32(minBitrate) / max},
+	}
+
+	for _, tt := range tests {
+		b := newBandwidthEstimator(max)
+		b.estimate = tt.bitrate
+		if got := b.frameRate(30); math.Abs(float64(got-tt.want)) > 0.01 {
+			t.Errorf("frame rate at %dkbps = %.2f, want %.2f", tt.bitrate, got, tt.want)
+		}
+	}
+
+	// Even a trickle of bits gets some frames through
+	b := newBandwidthEstimator(100000)
+	b.estimate = minBitrate
+	if got := b.frameRate(30); got != minFrameRate {
+		t.Errorf("frame rate at the minimum bitrate = %.2f, want %d", got, minFrameRate)
+	}
+}
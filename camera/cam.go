@@ -3,3 +3,35 @@ package camera
 import "image"
 
 type FrameCallback func(image.Image, error)
+
+// Device is a camera attached to the computer
+type Device struct {
+	// ID is passed to Camera.Start to use this device
+	ID   int
+	Name string
+
+	Formats []Format
+}
+
+// Format is a pixel format a camera can capture in
+type Format struct {
+	Name string
+	// Sizes lists the resolutions supported in this format. Devices that
+	// support a range of sizes list the smallest and largest.
+	Sizes []Size
+}
+
+// Size is a frame resolution in pixels
+type Size struct {
+	Width, Height int
+}
+
+// Source is anything that delivers frames like a camera: a webcam, a test
+// pattern or a video file
+type Source interface {
+	// Start begins sending frames of the given size to the callback.
+	// Starting a running source switches it over to camID.
+	Start(camID, width, height int, frameRate float32) error
+	// Close stops the source. It can be started again afterwards.
+	Close() error
+}
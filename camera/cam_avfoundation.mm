@@ -102,6 +102,7 @@ public:
   ~Capture();
 
   int start(int cam_id, int width, int height);
+  int stop();
 
 private:
   AVCaptureSession *mSession;
@@ -117,9 +118,18 @@ private:
 Capture::Capture(FrameCallback callback, void *userdata) {
   mCallback = callback;
   mUserdata = userdata;
+
+  mSession = nil;
+  mInput = nil;
+  mOutput = nil;
+  mCamera = nil;
+  mDelegate = nil;
 }
 
 int Capture::start(int cam_id, int width, int height) {
+  // Switch over if we're already running
+  stop();
+
   NSAutoreleasePool *pool = [[NSAutoreleasePool alloc] init];
 
   NSArray *cameras = [[AVCaptureDevice devicesWithMediaType:AVMediaTypeVideo]
@@ -172,6 +182,31 @@ int Capture::start(int cam_id, int width, int height) {
   return E_OK;
 }
 
+// stop ends the capture session and releases everything start allocated
+int Capture::stop() {
+  if (mSession) {
+    [mSession stopRunning];
+    [mSession release];
+    mSession = nil;
+  }
+  if (mOutput) {
+    [mOutput setSampleBufferDelegate:nil queue:nil];
+    [mOutput release];
+    mOutput = nil;
+  }
+  if (mInput) {
+    [mInput release];
+    mInput = nil;
+  }
+  if (mDelegate) {
+    [mDelegate release];
+    mDelegate = nil;
+  }
+  mCamera = nil;
+
+  return E_OK;
+}
+
 extern "C" {
 
 // cam_init allocates a new Camera and sets its frame callback
@@ -191,4 +226,10 @@ int cam_start(Camera cam, int cam_id, int width, int height) {
   Capture *capture = (Capture *)cam;
   return capture->start(cam_id, width, height);
 };
+
+// cam_close stops a Camera. It can be started again with cam_start.
+int cam_close(Camera cam) {
+  Capture *capture = (Capture *)cam;
+  return capture->stop();
+};
 }
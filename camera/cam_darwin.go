@@ -12,6 +12,7 @@ void onFrame_cgo(void *userdata, void *buf, int len, int width, int height) {
 */
 import "C"
 import (
+	"errors"
 	"fmt"
 	"unsafe"
 
@@ -46,15 +47,20 @@ func (c CamError) Error() string {
 	}
 }
 
-func (c *Camera) Start(camID, width, height int) error {
+// Start begins capturing from the camera with the given ID. AVFoundation
+// picks the frame rate, so callers should drop frames they don't need.
+func (c *Camera) Start(camID, width, height int, frameRate float32) error {
 	if ret := C.cam_start(c.c, C.int(camID), C.int(width), C.int(height)); ret != 0 {
 		return CamError(ret)
 	}
 	return nil
 }
 
+// Close stops the camera. It can be started again afterwards.
 func (c *Camera) Close() error {
-	// TODO
+	if ret := C.cam_close(c.c); ret != 0 {
+		return CamError(ret)
+	}
 	return nil
 }
 
@@ -62,6 +68,12 @@ func (c *Camera) onFrame(data []byte, width, height int) {
 	c.callback(yuv.FromI420(data, width, height))
 }
 
+// Devices lists the cameras on the system. This isn't supported on macOS
+// yet.
+func Devices() ([]Device, error) {
+	return nil, errors.New("listing cameras is only supported on Linux")
+}
+
 func New(cb FrameCallback) (*Camera, error) {
 	cam := &Camera{}
 
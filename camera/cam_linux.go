@@ -3,75 +3,293 @@ package camera
 import (
 	"bytes"
 	"fmt"
+	"image"
 	"image/jpeg"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/blackjack/webcam"
+	"github.com/dialup-inc/ascii/yuv"
 )
 
 const webcamReadTimeout = 5
 
 type Camera struct {
 	callback FrameCallback
+
+	mu sync.Mutex
+	// stop ends the stream that's running, if any
+	stop func()
+	// camID is the camera that's streaming while stop is set
+	camID int
+}
+
+func devicePath(camID int) string {
+	return fmt.Sprintf("/dev/video%d", camID)
 }
 
-func (c *Camera) Start(camID, width, height int) error {
-	cam, err := webcam.Open("/dev/video0")
+// Start begins reading frames from the camera with the given ID. If the
+// camera is already running, it switches over to the new device.
+func (c *Camera) Start(camID, width, height int, frameRate float32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A device can't change format while it's streaming, so restarting
+	// the same camera has to stop it first. Switching to another device
+	// keeps the old one going until the new one is ready.
+	if c.stop != nil && c.camID == camID {
+		c.stop()
+		c.stop = nil
+	}
+
+	cam, err := webcam.Open(devicePath(camID))
 	if err != nil {
 		return err
 	}
 
-	var selectedFormat webcam.PixelFormat
-	for v, k := range cam.GetSupportedFormats() {
-		if strings.HasPrefix(k, "Motion-JPEG") {
-			selectedFormat = v
-			break
-		}
+	format, err := chooseFormat(cam, width, height)
+	if err != nil {
+		cam.Close()
+		return err
 	}
 
-	if selectedFormat == 0 {
-		return fmt.Errorf("Only Motion-JPEG supported")
+	code, w, h, err := cam.SetImageFormat(format.code, uint32(width), uint32(height))
+	if err != nil {
+		cam.Close()
+		return err
+	}
+	// Drivers can pick something else if they don't like what we asked
+	// for. Frames of another size are scaled by the caller, but we can't
+	// decode another format.
+	if code != format.code {
+		cam.Close()
+		return fmt.Errorf("camera switched to an unsupported pixel format %v", code)
 	}
+	width, height = int(w), int(h)
 
-	if _, _, _, err = cam.SetImageFormat(selectedFormat, uint32(width), uint32(height)); err != nil {
+	if err := setFrameRate(devicePath(camID), frameRate); err != nil {
+		cam.Close()
 		return err
 	}
 
+	if c.stop != nil {
+		c.stop()
+		c.stop = nil
+	}
+
 	if err = cam.StartStreaming(); err != nil {
+		cam.Close()
 		return err
 	}
 
-	go func() {
-		for {
-			err = cam.WaitForFrame(webcamReadTimeout)
-			switch err.(type) {
-			case nil:
-			case *webcam.Timeout:
-				fmt.Fprint(os.Stderr, err.Error())
-				continue
-			default:
-				c.callback(nil, err)
-				return
-			}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	c.stop = func() {
+		close(stop)
+		<-done
+	}
+
+	c.camID = camID
 
-			frame, err := cam.ReadFrame()
-			if len(frame) != 0 {
-				img, err := jpeg.Decode(bytes.NewReader(frame))
-				c.callback(img, err)
-			} else if err != nil {
-				c.callback(nil, err)
+	decode := func(frame []byte) (image.Image, error) {
+		return format.decode(frame, width, height)
+	}
+	go c.stream(cam, decode, stop, done)
+	return nil
+}
+
+// pixelFormat is a V4L2 pixel format we know how to decode
+type pixelFormat struct {
+	code webcam.PixelFormat
+	// raw formats need the exact frame size to be supported, since we
+	// can't tell from the frame if the driver picked another one
+	raw    bool
+	decode func(frame []byte, width, height int) (image.Image, error)
+}
+
+func fourcc(s string) webcam.PixelFormat {
+	return webcam.PixelFormat(uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24)
+}
+
+// pixelFormats are the formats we support, best first. Raw YUV is
+// preferred because it doesn't need decoding and goes straight to the
+// encoder.
+var pixelFormats = []pixelFormat{
+	{fourcc("YU12"), true, func(frame []byte, width, height int) (image.Image, error) {
+		// The frame's buffer is reused by the driver
+		return yuv.FromI420(append([]byte(nil), frame...), width, height)
+	}},
+	{fourcc("NV12"), true, func(frame []byte, width, height int) (image.Image, error) {
+		return yuv.FromNV12(frame, width, height)
+	}},
+	{fourcc("YUYV"), true, func(frame []byte, width, height int) (image.Image, error) {
+		return yuv.FromYUYV(frame, width, height)
+	}},
+	{fourcc("MJPG"), false, func(frame []byte, width, height int) (image.Image, error) {
+		return jpeg.Decode(bytes.NewReader(frame))
+	}},
+}
+
+// chooseFormat picks the best pixel format the camera supports
+func chooseFormat(cam *webcam.Webcam, width, height int) (pixelFormat, error) {
+	supported := cam.GetSupportedFormats()
+
+	for _, f := range pixelFormats {
+		if _, ok := supported[f.code]; !ok {
+			continue
+		}
+		if f.raw && !supportsSize(cam.GetSupportedFrameSizes(f.code), width, height) {
+			continue
+		}
+		return f, nil
+	}
+
+	var names []string
+	for _, name := range supported {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return pixelFormat{}, fmt.Errorf("no supported pixel format at %dx%d (camera has %s)", width, height, strings.Join(names, ", "))
+}
+
+func supportsSize(sizes []webcam.FrameSize, width, height int) bool {
+	w, h := uint32(width), uint32(height)
+
+	for _, s := range sizes {
+		if w < s.MinWidth || w > s.MaxWidth || h < s.MinHeight || h > s.MaxHeight {
+			continue
+		}
+		if s.StepWidth == 0 && s.StepHeight == 0 {
+			// A discrete size
+			if w == s.MaxWidth && h == s.MaxHeight {
+				return true
 			}
+			continue
 		}
-	}()
-	return nil
+		if (s.StepWidth == 0 || (w-s.MinWidth)%s.StepWidth == 0) &&
+			(s.StepHeight == 0 || (h-s.MinHeight)%s.StepHeight == 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Camera) stream(cam *webcam.Webcam, decode func([]byte) (image.Image, error), stop, done chan struct{}) {
+	defer close(done)
+	defer cam.Close()
+
+	for {
+		select {
+		case <-stop:
+			cam.StopStreaming()
+			return
+		default:
+		}
+
+		err := cam.WaitForFrame(webcamReadTimeout)
+		switch err.(type) {
+		case nil:
+		case *webcam.Timeout:
+			fmt.Fprint(os.Stderr, err.Error())
+			continue
+		default:
+			c.callback(nil, err)
+			return
+		}
+
+		// Decode before handing the buffer back to the driver
+		frame, index, err := cam.GetFrame()
+		if err != nil {
+			c.callback(nil, err)
+			continue
+		}
+		img, err := decode(frame)
+		cam.ReleaseFrame(index)
+
+		c.callback(img, err)
+	}
 }
 
+// Close stops the stream and releases the device. The camera can be
+// started again afterwards.
 func (c *Camera) Close() error {
-	// TODO
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		c.stop()
+		c.stop = nil
+	}
 	return nil
 }
 
 func New(cb FrameCallback) (*Camera, error) {
 	return &Camera{callback: cb}, nil
 }
+
+// Devices lists the V4L2 video capture devices on the system
+func Devices() ([]Device, error) {
+	paths, err := filepath.Glob("/dev/video*")
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for _, path := range paths {
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "/dev/video"))
+		if err != nil {
+			continue
+		}
+
+		// Some devices are for metadata, not video, and fail to open
+		cam, err := webcam.Open(path)
+		if err != nil {
+			continue
+		}
+
+		devices = append(devices, Device{
+			ID:      id,
+			Name:    deviceName(id),
+			Formats: deviceFormats(cam),
+		})
+		cam.Close()
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
+	return devices, nil
+}
+
+// deviceName reads the name the driver gives a device from sysfs
+func deviceName(camID int) string {
+	name, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/video4linux/video%d/name", camID))
+	if err != nil {
+		return devicePath(camID)
+	}
+	return strings.TrimSpace(string(name))
+}
+
+func deviceFormats(cam *webcam.Webcam) []Format {
+	var formats []Format
+	for code, name := range cam.GetSupportedFormats() {
+		var sizes []Size
+		for _, fs := range cam.GetSupportedFrameSizes(code) {
+			sizes = append(sizes, Size{int(fs.MinWidth), int(fs.MinHeight)})
+			if fs.MaxWidth != fs.MinWidth || fs.MaxHeight != fs.MinHeight {
+				sizes = append(sizes, Size{int(fs.MaxWidth), int(fs.MaxHeight)})
+			}
+		}
+		formats = append(formats, Format{Name: name, Sizes: sizes})
+	}
+
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i].Name < formats[j].Name
+	})
+	return formats
+}
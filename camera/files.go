@@ -0,0 +1,196 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	// Formats for NewImageDir
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/dialup-inc/ascii/videos"
+	"github.com/dialup-inc/ascii/vpx"
+)
+
+// NewIVF creates a source that loops a VP8 or VP9 video from an IVF file
+func NewIVF(path string, cb FrameCallback) Source {
+	return &player{
+		callback: cb,
+		open: func(width, height int) (generator, error) {
+			return openIVF(path, width, height)
+		},
+	}
+}
+
+type ivfLoop struct {
+	file    *os.File
+	reader  *videos.IVFReader
+	decoder *vpx.Decoder
+
+	width, height int
+
+	// period is how long each frame of the file is shown
+	period time.Duration
+	// next is when the next frame of the file is due
+	next time.Duration
+	last image.Image
+}
+
+func openIVF(path string, width, height int) (*ivfLoop, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := videos.NewIVFReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	codec, err := reader.VPXCodec()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	hdr := reader.Header
+	if hdr.FrameRate == 0 || hdr.FrameScale == 0 {
+		f.Close()
+		return nil, fmt.Errorf("invalid frame rate in %s", path)
+	}
+
+	decoder, err := vpx.NewDecoder(codec)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &ivfLoop{
+		file:    f,
+		reader:  reader,
+		decoder: decoder,
+		width:   width,
+		height:  height,
+		period:  time.Duration(float64(hdr.FrameScale) / float64(hdr.FrameRate) * float64(time.Second)),
+	}, nil
+}
+
+// frame decodes frames until it catches up with t, so the video plays at
+// its own speed whatever rate we're called at
+func (v *ivfLoop) frame(t time.Duration) (image.Image, error) {
+	var latest image.Image
+	rewound := false
+	for v.next <= t {
+		data, _, err := v.reader.ReadFrame()
+		if err == io.EOF {
+			if rewound {
+				return nil, errors.New("IVF file has no frames")
+			}
+			if err := v.reader.Rewind(); err != nil {
+				return nil, err
+			}
+			rewound = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rewound = false
+
+		img, err := v.decoder.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		if img != nil {
+			latest = img
+		}
+		v.next += v.period
+	}
+
+	if latest != nil {
+		v.last = latest
+	}
+
+	if v.last == nil {
+		return nil, errors.New("no frame decoded yet")
+	}
+	return fit(v.last, v.width, v.height), nil
+}
+
+func (v *ivfLoop) close() error {
+	v.decoder.Close()
+	return v.file.Close()
+}
+
+// slideDuration is how long each image from a directory is shown
+const slideDuration = 2 * time.Second
+
+// NewImageDir creates a source that shows the PNG, JPEG and GIF images in
+// a directory one after another, in name order
+func NewImageDir(dir string, cb FrameCallback) Source {
+	return &player{
+		callback: cb,
+		open: func(width, height int) (generator, error) {
+			return loadSlides(dir, width, height)
+		},
+	}
+}
+
+type slideshow []image.Image
+
+func loadSlides(dir string, width, height int) (slideshow, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	var slides slideshow
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+
+		img, err := loadImage(filepath.Join(dir, fi.Name()))
+		if err == image.ErrFormat {
+			// Not an image
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		slides = append(slides, fit(img, width, height))
+	}
+
+	if len(slides) == 0 {
+		return nil, fmt.Errorf("no images found in %s", dir)
+	}
+	return slides, nil
+}
+
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+func (s slideshow) frame(t time.Duration) (image.Image, error) {
+	return s[int(t/slideDuration)%len(s)], nil
+}
+
+func (s slideshow) close() error { return nil }
@@ -0,0 +1,195 @@
+package camera
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"time"
+)
+
+// Pattern is a synthetic picture for testing without a webcam
+type Pattern int
+
+const (
+	// PatternBars shows color bars
+	PatternBars Pattern = iota
+	// PatternBox shows a box bouncing around the frame
+	PatternBox
+	// PatternClock shows the current time to the millisecond, which makes
+	// it easy to measure delay between the two ends of a call
+	PatternClock
+)
+
+func (p Pattern) String() string {
+	switch p {
+	case PatternBars:
+		return "bars"
+	case PatternBox:
+		return "box"
+	case PatternClock:
+		return "clock"
+	default:
+		return fmt.Sprintf("Pattern(%d)", int(p))
+	}
+}
+
+// ParsePattern reads a pattern name
+func ParsePattern(s string) (Pattern, error) {
+	switch strings.ToLower(s) {
+	case "bars":
+		return PatternBars, nil
+	case "box":
+		return PatternBox, nil
+	case "clock":
+		return PatternClock, nil
+	default:
+		return 0, fmt.Errorf("unknown pattern %q", s)
+	}
+}
+
+// NewPattern creates a source that shows a test pattern
+func NewPattern(p Pattern, cb FrameCallback) Source {
+	return &player{
+		callback: cb,
+		open: func(width, height int) (generator, error) {
+			switch p {
+			case PatternBars:
+				return stillFrame{colorBars(width, height)}, nil
+			case PatternBox:
+				return &bouncingBox{width: width, height: height}, nil
+			case PatternClock:
+				return &clock{width: width, height: height}, nil
+			default:
+				return nil, fmt.Errorf("unknown pattern %v", p)
+			}
+		},
+	}
+}
+
+// stillFrame shows the same image forever
+type stillFrame struct {
+	img image.Image
+}
+
+func (s stillFrame) frame(time.Duration) (image.Image, error) { return s.img, nil }
+func (s stillFrame) close() error                             { return nil }
+
+// barColors are the 75% bars from the top of the SMPTE test pattern
+var barColors = []color.RGBA{
+	{0xbf, 0xbf, 0xbf, 0xff},
+	{0xbf, 0xbf, 0x00, 0xff},
+	{0x00, 0xbf, 0xbf, 0xff},
+	{0x00, 0xbf, 0x00, 0xff},
+	{0xbf, 0x00, 0xbf, 0xff},
+	{0xbf, 0x00, 0x00, 0xff},
+	{0x00, 0x00, 0xbf, 0xff},
+}
+
+func colorBars(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// The bottom quarter is a gray ramp, to check brightness and dithering
+	top := height * 3 / 4
+	for i, c := range barColors {
+		x0 := i * width / len(barColors)
+		x1 := (i + 1) * width / len(barColors)
+		draw.Draw(img, image.Rect(x0, 0, x1, top), image.NewUniform(c), image.ZP, draw.Src)
+	}
+	for x := 0; x < width; x++ {
+		v := uint8(x * 0xff / width)
+		draw.Draw(img, image.Rect(x, top, x+1, height), image.NewUniform(color.Gray{v}), image.ZP, draw.Src)
+	}
+
+	return img
+}
+
+// boxSpeed is how far the bouncing box moves, in frame widths per second
+const boxSpeed = 0.4
+
+type bouncingBox struct {
+	width, height int
+}
+
+func (b *bouncingBox) frame(t time.Duration) (image.Image, error) {
+	img := image.NewRGBA(image.Rect(0, 0, b.width, b.height))
+	draw.Draw(img, img.Rect, image.NewUniform(color.Gray{0x40}), image.ZP, draw.Src)
+
+	size := b.height / 4
+	dist := t.Seconds() * boxSpeed * float64(b.width)
+	x := bounce(dist, b.width-size)
+	// Move vertically at a different rate so the box covers the whole frame
+	y := bounce(dist*0.7, b.height-size)
+
+	draw.Draw(img, image.Rect(x, y, x+size, y+size), image.White, image.ZP, draw.Src)
+	return img, nil
+}
+
+func (b *bouncingBox) close() error { return nil }
+
+// bounce folds a distance traveled into a position that goes back and
+// forth between 0 and max
+func bounce(dist float64, max int) int {
+	if max <= 0 {
+		return 0
+	}
+	pos := int(dist) % (2 * max)
+	if pos > max {
+		pos = 2*max - pos
+	}
+	return pos
+}
+
+// digitFont is a 3x5 bitmap font for the clock, one string per row
+var digitFont = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", "..#", "..#"},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	':': {"...", ".#.", "...", ".#.", "..."},
+	'.': {"...", "...", "...", "...", ".#."},
+}
+
+type clock struct {
+	width, height int
+}
+
+func (c *clock) frame(time.Duration) (image.Image, error) {
+	img := image.NewRGBA(image.Rect(0, 0, c.width, c.height))
+	draw.Draw(img, img.Rect, image.Black, image.ZP, draw.Src)
+
+	text := time.Now().Format("15:04:05.000")
+
+	// Each character is 3 pixels wide plus a gap, and we leave a
+	// character's width of margin
+	scale := c.width / ((len(text) + 1) * 4)
+	if scale < 1 {
+		scale = 1
+	}
+	x := (c.width - len(text)*4*scale) / 2
+	y := (c.height - 5*scale) / 2
+
+	for _, r := range text {
+		for row, line := range digitFont[r] {
+			for col, px := range line {
+				if px != '#' {
+					continue
+				}
+				dot := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+				draw.Draw(img, dot, image.White, image.ZP, draw.Src)
+			}
+		}
+		x += 4 * scale
+	}
+
+	return img, nil
+}
+
+func (c *clock) close() error { return nil }
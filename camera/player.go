@@ -0,0 +1,97 @@
+package camera
+
+import (
+	"errors"
+	"image"
+	"sync"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+// generator makes the frames for a source that isn't a real camera
+type generator interface {
+	// frame returns the picture to show at time t after the source started
+	frame(t time.Duration) (image.Image, error)
+	close() error
+}
+
+// player runs a generator at a steady frame rate, the way a camera would
+type player struct {
+	callback FrameCallback
+	// open prepares a generator for frames of the given size
+	open func(width, height int) (generator, error)
+
+	mu sync.Mutex
+	// stop ends the generator that's running, if any
+	stop func()
+}
+
+func (p *player) Start(camID, width, height int, frameRate float32) error {
+	if frameRate <= 0 {
+		return errors.New("frame rate must be positive")
+	}
+
+	gen, err := p.open(width, height)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stop != nil {
+		p.stop()
+		p.stop = nil
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	p.stop = func() {
+		close(stop)
+		<-done
+	}
+
+	interval := time.Duration(float32(time.Second) / frameRate)
+	go p.run(gen, interval, stop, done)
+	return nil
+}
+
+func (p *player) run(gen generator, interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	defer gen.close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			p.callback(gen.frame(now.Sub(start)))
+		}
+	}
+}
+
+func (p *player) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stop != nil {
+		p.stop()
+		p.stop = nil
+	}
+	return nil
+}
+
+// fit stretches img to exactly width by height, which is what the encoder
+// expects from a camera
+func fit(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	if b.Dx() == width && b.Dy() == height {
+		return img
+	}
+	return resize.Resize(uint(width), uint(height), img, resize.Bilinear)
+}
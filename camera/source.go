@@ -0,0 +1,49 @@
+package camera
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Open creates the frame source named by spec, as used in command line
+// flags:
+//
+//	webcam         a real camera (the default)
+//	bars           color bars
+//	box            a bouncing box
+//	clock          the current time
+//	ivf:<path>     a VP8 or VP9 video file, looped
+//	images:<dir>   the images in a directory, as a slideshow
+func Open(spec string, cb FrameCallback) (Source, error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	switch strings.ToLower(kind) {
+	case "", "webcam":
+		return New(cb)
+	case "ivf":
+		if arg == "" {
+			return nil, fmt.Errorf("camera source %q needs a file, like ivf:video.ivf", spec)
+		}
+		return NewIVF(arg, cb), nil
+	case "images":
+		if arg == "" {
+			return nil, fmt.Errorf("camera source %q needs a directory, like images:photos", spec)
+		}
+		return NewImageDir(arg, cb), nil
+	}
+
+	p, err := ParsePattern(kind)
+	if err != nil {
+		return nil, fmt.Errorf("unknown camera source %q", spec)
+	}
+	return NewPattern(p, cb), nil
+}
+
+// IsWebcam reports whether spec names a real camera
+func IsWebcam(spec string) bool {
+	s := strings.ToLower(spec)
+	return s == "" || s == "webcam"
+}
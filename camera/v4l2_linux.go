@@ -0,0 +1,83 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The webcam package doesn't expose frame intervals, so we set them with
+// our own ioctls. These mirror the definitions in linux/videodev2.h.
+const (
+	vidiocGParm = 0xc0cc5615
+	vidiocSParm = 0xc0cc5616
+
+	v4l2BufTypeVideoCapture = 1
+	v4l2CapTimePerFrame     = 0x1000
+)
+
+type v4l2Fract struct {
+	numerator   uint32
+	denominator uint32
+}
+
+type v4l2CaptureParm struct {
+	capability   uint32
+	capturemode  uint32
+	timeperframe v4l2Fract
+	extendedmode uint32
+	readbuffers  uint32
+	reserved     [4]uint32
+}
+
+type v4l2StreamParm struct {
+	typ     uint32
+	capture v4l2CaptureParm
+	// pad out the rest of the union
+	_ [200 - unsafe.Sizeof(v4l2CaptureParm{})]byte
+}
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setFrameRate asks the driver of the webcam at path to capture at
+// frameRate frames per second. Drivers round to the nearest interval they
+// support. Some can't change the rate at all, which isn't an error since
+// the caller drops extra frames anyway.
+//
+// The webcam package keeps its descriptor to itself, so this opens the
+// device again. The rate belongs to the device rather than the descriptor,
+// but it has to be set before streaming starts.
+func setFrameRate(path string, frameRate float32) error {
+	if frameRate <= 0 {
+		return errors.New("frame rate must be positive")
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fd := f.Fd()
+
+	parm := v4l2StreamParm{typ: v4l2BufTypeVideoCapture}
+	if err := ioctl(fd, vidiocGParm, unsafe.Pointer(&parm)); err != nil {
+		return fmt.Errorf("get frame rate: %v", err)
+	}
+	if parm.capture.capability&v4l2CapTimePerFrame == 0 {
+		return nil
+	}
+
+	parm.capture.timeperframe = v4l2Fract{numerator: 1000, denominator: uint32(frameRate * 1000)}
+	if err := ioctl(fd, vidiocSParm, unsafe.Pointer(&parm)); err != nil {
+		return fmt.Errorf("set frame rate: %v", err)
+	}
+	return nil
+}
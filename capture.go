@@ -1,28 +1,34 @@
 package ascii
 
 import (
+	"errors"
+	"fmt"
 	"image"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/dialup-inc/ascii/camera"
 	"github.com/dialup-inc/ascii/vpx"
+	"github.com/nfnt/resize"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
 	"github.com/pion/webrtc/v2"
-	"github.com/pion/webrtc/v2/pkg/media"
 )
 
+// rtpMTU is the most payload we put in an RTP packet, leaving room for
+// the headers added by SRTP, UDP and IP
+const rtpMTU = 1200
+
 func NewCapture(width, height int) (*Capture, error) {
 	cap := &Capture{
 		vpxBuf: make([]byte, 5*1024*1024),
 		width:  width,
 		height: height,
-	}
 
-	enc, err := vpx.NewEncoder(width, height)
-	if err != nil {
-		return nil, err
+		OnFrame:       func(image.Image) {},
+		EncoderConfig: vpx.DefaultEncoderConfig(width, height),
 	}
-	cap.enc = enc
 
 	cam, err := camera.New(cap.onFrame)
 	if err != nil {
@@ -34,38 +40,301 @@ func NewCapture(width, height int) (*Capture, error) {
 }
 
 type Capture struct {
-	enc *vpx.Encoder
-	cam *camera.Camera
+	// enc is nil while capture is stopped
+	encMu sync.Mutex
+	enc   *vpx.Encoder
 
+	cam camera.Source
+
+	// The frame size is only changed while holding both camMu and encMu
 	width  int
 	height int
 
-	ptsMu sync.Mutex
-	pts   int
+	camMu     sync.Mutex
+	camID     int
+	frameRate float32
+	started   bool
+
+	// Pacing, timestamps and bandwidth are only touched while holding encMu
+	pace pacer
+	bwe  bandwidthEstimator
+	// baseRate is the frame rate asked for in Start
+	baseRate float32
+	// start is when the first frame since Start was encoded
+	start time.Time
+	// lastFrame is the capture time of the last frame sent
+	lastFrame time.Time
+	// ticks is the 90kHz clock time of the last frame sent, counted from
+	// the packetizer's starting timestamp
+	ticks uint32
 
 	vpxBuf []byte
 
 	forceKeyframe uint32
 	encodeLock    uint32
 
-	track *webrtc.Track
+	track      rtpWriter
+	packetizer rtp.Packetizer
+	// codec is what the encoder produces, which can differ from the
+	// configured codec if our partner doesn't support it
+	codec vpx.Codec
+
+	// OnFrame is called with every frame from the camera, before encoding
+	OnFrame func(image.Image)
+
+	// EncoderConfig is used for the encoder made when capture starts
+	EncoderConfig vpx.EncoderConfig
 }
 
+// Start begins capturing from a camera, keeping at most frameRate frames
+// per second
 func (c *Capture) Start(camID int, frameRate float32) error {
-	return c.cam.Start(camID, c.width, c.height)
+	if frameRate <= 0 {
+		return errors.New("frame rate must be positive")
+	}
+
+	c.camMu.Lock()
+	defer c.camMu.Unlock()
+
+	// The encoder is released when capture stops, so make a new one
+	c.encMu.Lock()
+	if c.enc == nil {
+		// Keep the codec negotiated for the current call, if any
+		if c.track == nil {
+			c.codec = c.EncoderConfig.Codec
+		}
+		enc, err := c.newEncoder()
+		if err != nil {
+			c.encMu.Unlock()
+			return err
+		}
+		c.enc = enc
+	}
+	c.pace = pacer{interval: frameInterval(frameRate)}
+	c.baseRate = frameRate
+	c.bwe = newBandwidthEstimator(c.EncoderConfig.TargetBitrate)
+	c.start = time.Time{}
+	c.encMu.Unlock()
+
+	if err := c.cam.Start(camID, c.width, c.height, frameRate); err != nil {
+		return err
+	}
+	c.camID = camID
+	c.frameRate = frameRate
+	c.started = true
+	return nil
 }
 
-func (c *Capture) Stop() error {
-	// TODO
+// SetSource changes where frames come from to a source named as in
+// camera.Open. Capture must be stopped.
+func (c *Capture) SetSource(spec string) error {
+	c.camMu.Lock()
+	defer c.camMu.Unlock()
+
+	if c.started {
+		return errors.New("can't change source while capturing")
+	}
+
+	src, err := camera.Open(spec, c.onFrame)
+	if err != nil {
+		return err
+	}
+	c.cam = src
+	return nil
+}
+
+// SwitchCamera moves capture over to another camera. The track keeps
+// going, so the call carries on without renegotiating.
+func (c *Capture) SwitchCamera(camID int) error {
+	c.camMu.Lock()
+	defer c.camMu.Unlock()
+
+	if !c.started {
+		return errors.New("camera hasn't started")
+	}
+
+	if err := c.cam.Start(camID, c.width, c.height, c.frameRate); err != nil {
+		return err
+	}
+	c.camID = camID
+
+	// The partner's decoder needs a fresh picture from the new camera
+	c.RequestKeyframe()
+	return nil
+}
+
+// SetBitrate changes the bitrate of the video being sent, in kilobits per
+// second
+func (c *Capture) SetBitrate(kbps int) error {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	if c.enc != nil {
+		if err := c.enc.SetBitrate(kbps); err != nil {
+			return err
+		}
+	}
+	c.EncoderConfig.TargetBitrate = kbps
+	c.bwe = newBandwidthEstimator(kbps)
+	return nil
+}
+
+// ReceiverReport adapts the video to the loss and jitter our partner
+// reports
+func (c *Capture) ReceiverReport(fractionLost uint8, jitter uint32) {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	c.bwe.onReceiverReport(fractionLost, jitter)
+	c.adapt()
+}
+
+// EstimatedBitrate limits the video to the bitrate, in bits per second,
+// that our partner estimates they can receive
+func (c *Capture) EstimatedBitrate(bps uint64) {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	c.bwe.onREMB(bps)
+	c.adapt()
+}
+
+// adapt applies the bandwidth estimate to the encoder and frame rate. It's
+// called with encMu held.
+func (c *Capture) adapt() {
+	if c.enc == nil || c.bwe.max == 0 {
+		return
+	}
+
+	// The configured bitrate is left alone so the estimate can climb back
+	// up to it
+	if err := c.enc.SetBitrate(c.bwe.bitrate()); err != nil {
+		return
+	}
+	c.pace.interval = frameInterval(c.bwe.frameRate(c.baseRate))
+}
+
+// SetResolution changes the size of the video being sent. The camera is
+// restarted at the new size without interrupting the call.
+func (c *Capture) SetResolution(width, height int) error {
+	c.camMu.Lock()
+	defer c.camMu.Unlock()
+
+	c.encMu.Lock()
+	if c.enc != nil {
+		if err := c.enc.SetResolution(width, height); err != nil {
+			c.encMu.Unlock()
+			return err
+		}
+	}
+	c.width, c.height = width, height
+	c.encMu.Unlock()
+
+	if !c.started {
+		return nil
+	}
+
+	// Frames at the old size are scaled until the camera switches over
+	if err := c.cam.Start(c.camID, width, height, c.frameRate); err != nil {
+		return err
+	}
+	c.RequestKeyframe()
 	return nil
 }
 
+// CameraID returns the ID of the camera being captured from
+func (c *Capture) CameraID() int {
+	c.camMu.Lock()
+	defer c.camMu.Unlock()
+
+	return c.camID
+}
+
+// Stop turns off the camera and releases the encoder. Capture can be
+// started again afterwards.
+func (c *Capture) Stop() error {
+	c.camMu.Lock()
+	defer c.camMu.Unlock()
+
+	// Once the camera is closed there won't be any more frames to encode
+	var camErr error
+	if c.started {
+		camErr = c.cam.Close()
+		c.started = false
+	}
+
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	var encErr error
+	if c.enc != nil {
+		encErr = c.enc.Close()
+		c.enc = nil
+	}
+
+	if camErr != nil {
+		return camErr
+	}
+	return encErr
+}
+
 func (c *Capture) RequestKeyframe() {
 	atomic.StoreUint32(&c.forceKeyframe, 1)
 }
 
-func (c *Capture) SetTrack(track *webrtc.Track) {
+// newEncoder makes an encoder for the current codec and frame size. It's
+// called with encMu held.
+func (c *Capture) newEncoder() (*vpx.Encoder, error) {
+	cfg := c.EncoderConfig
+	cfg.Codec = c.codec
+	return vpx.NewEncoder(c.width, c.height, cfg)
+}
+
+// rtpWriter is where encoded video goes. It's a *webrtc.Track outside of
+// tests.
+type rtpWriter interface {
+	WriteRTP(*rtp.Packet) error
+}
+
+// SetTrack sends video to track, encoded with codec and sent with the
+// payload type our partner expects for it
+func (c *Capture) SetTrack(track *webrtc.Track, codec vpx.Codec, payloadType uint8) error {
+	return c.setWriter(track, track.SSRC(), codec, payloadType)
+}
+
+func (c *Capture) setWriter(track rtpWriter, ssrc uint32, codec vpx.Codec, payloadType uint8) error {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	var payloader rtp.Payloader
+	switch codec {
+	case vpx.VP8:
+		payloader = &codecs.VP8Payloader{}
+	case vpx.VP9:
+		payloader = &vp9Payloader{}
+	default:
+		return fmt.Errorf("can't send %v", codec)
+	}
+
+	if codec != c.codec && c.enc != nil {
+		c.codec = codec
+		enc, err := c.newEncoder()
+		if err != nil {
+			return err
+		}
+		c.enc.Close()
+		c.enc = enc
+	}
+	c.codec = codec
+
 	c.track = track
+	c.packetizer = rtp.NewPacketizer(rtpMTU, payloadType, ssrc, payloader, rtp.NewRandomSequencer(), videoClockRate)
+	c.RequestKeyframe()
+
+	// Start each call at full quality
+	c.bwe = newBandwidthEstimator(c.EncoderConfig.TargetBitrate)
+	c.adapt()
+	return nil
 }
 
 func (c *Capture) onFrame(img image.Image, err error) {
@@ -78,24 +347,88 @@ func (c *Capture) onFrame(img image.Image, err error) {
 	}
 	defer atomic.StoreUint32(&c.encodeLock, 0)
 
+	// The preview only gets the frames we keep, so the UI doesn't redraw at
+	// the camera's full rate
+	if c.encode(img) {
+		c.OnFrame(img)
+	}
+}
+
+// encode sends img to our partner if the pacer keeps it, reporting
+// whether it was kept
+func (c *Capture) encode(img image.Image) bool {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+	if c.enc == nil {
+		return false
+	}
+
+	now := time.Now()
+	if !c.pace.take(now) {
+		return false
+	}
+	if c.start.IsZero() {
+		c.start = now
+		c.lastFrame = now.Add(-c.pace.interval)
+	}
+
+	// The encoder only takes frames of the size it was set up for
+	if b := img.Bounds(); b.Dx() != c.width || b.Dy() != c.height {
+		img = resize.Resize(uint(c.width), uint(c.height), img, resize.Bilinear)
+	}
+
 	forceKeyframe := atomic.CompareAndSwapUint32(&c.forceKeyframe, 1, 0)
 
-	n, err := c.enc.Encode(c.vpxBuf, img, c.pts, forceKeyframe)
+	// The encoder's timebase is milliseconds
+	pts := int(now.Sub(c.start) / time.Millisecond)
+	n, err := c.enc.Encode(c.vpxBuf, img, pts, forceKeyframe)
 	if err != nil {
 		// fmt.Println("encode: ", err)
-		return
+		return true
 	}
-	c.pts++
 
-	data := c.vpxBuf[:n]
-	samp := media.Sample{Data: data, Samples: 1}
+	// The packetizer stamps a frame before adding its samples, which
+	// would give every frame the time of the one before. Instead its
+	// clock is left alone and we add how far ours has moved.
+	c.ticks += uint32(now.Sub(c.lastFrame) * videoClockRate / time.Second)
+	c.lastFrame = now
 
 	if c.track == nil {
-		return
+		return true
 	}
 
-	if err := c.track.WriteSample(samp); err != nil {
-		// fmt.Println("write sample: ", err)
-		return
+	for _, pkt := range c.packetizer.Packetize(c.vpxBuf[:n], 0) {
+		pkt.Timestamp += c.ticks
+		if err := c.track.WriteRTP(pkt); err != nil {
+			// fmt.Println("write rtp: ", err)
+			break
+		}
+	}
+	return true
+}
+
+func frameInterval(frameRate float32) time.Duration {
+	return time.Duration(float32(time.Second) / frameRate)
+}
+
+// pacer drops frames evenly to bring a camera down to a lower frame rate
+type pacer struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// take reports whether a frame captured at t should be kept
+func (p *pacer) take(t time.Time) bool {
+	// Allow frames to come a bit early so jitter doesn't make us skip
+	// frames from a camera that's already running at our rate
+	if t.Before(p.next.Add(-p.interval / 2)) {
+		return false
+	}
+
+	p.next = p.next.Add(p.interval)
+	// Start over after a stall instead of letting frames through in a burst
+	if p.next.Before(t) {
+		p.next = t.Add(p.interval)
 	}
+	return true
 }
@@ -0,0 +1,208 @@
+package ascii
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dialup-inc/ascii/vpx"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v2/pkg/media/samplebuilder"
+)
+
+const (
+	testWidth  = 320
+	testHeight = 240
+)
+
+// packetRecorder keeps the packets a Capture sends, as they'd come off the
+// wire
+type packetRecorder struct {
+	mu      sync.Mutex
+	packets []*rtp.Packet
+}
+
+func (r *packetRecorder) WriteRTP(p *rtp.Packet) error {
+	buf, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	pkt := &rtp.Packet{}
+	if err := pkt.Unmarshal(buf); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packets = append(r.packets, pkt)
+	return nil
+}
+
+func copyImage(img image.Image) *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Rect, img, img.Bounds().Min, draw.Src)
+	return dst
+}
+
+// roundTrip captures frames from source and sends them with codec. It
+// returns the frames that were sent and what our partner would decode
+// from the packets. The sample builder never gives back the first frame,
+// so received[i] is sent[i+1].
+func roundTrip(t *testing.T, source string, codec vpx.Codec) (sent, received []*image.RGBA) {
+	t.Helper()
+	const frames = 10
+
+	c, err := NewCapture(testWidth, testHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSource(source); err != nil {
+		t.Fatal(err)
+	}
+	rec := &packetRecorder{}
+	if err := c.setWriter(rec, 1, codec, 96); err != nil {
+		t.Fatal(err)
+	}
+
+	enough := make(chan struct{})
+	c.OnFrame = func(img image.Image) {
+		// Sources can reuse their pictures for the next frame
+		sent = append(sent, copyImage(img))
+		if len(sent) == 1 {
+			// Our partner can't decode without the first keyframe, so
+			// ask for another like they would with a PLI
+			c.RequestKeyframe()
+		}
+		if len(sent) == frames {
+			close(enough)
+		}
+	}
+	if err := c.Start(0, 30); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-enough:
+	case <-time.After(5 * time.Second):
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) < frames {
+		t.Fatalf("only %d frames captured", len(sent))
+	}
+
+	var depacketizer rtp.Depacketizer = &codecs.VP8Packet{}
+	if codec == vpx.VP9 {
+		depacketizer = vp9Packet{}
+	}
+	builder := samplebuilder.New(rtpAverageFrameWidth*5, depacketizer)
+
+	dec, err := vpx.NewDecoder(codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+
+	for _, pkt := range rec.packets {
+		builder.Push(pkt)
+		for s := builder.Pop(); s != nil; s = builder.Pop() {
+			img, err := dec.Decode(s.Data)
+			if err != nil {
+				t.Fatalf("frame %d: %v", len(received), err)
+			}
+			if img != nil {
+				received = append(received, copyImage(img))
+			}
+		}
+	}
+
+	// The last frame stays in the sample builder until another one comes
+	if len(received) < len(sent)-2 {
+		t.Fatalf("decoded %d of %d frames", len(received), len(sent))
+	}
+	for i, img := range received {
+		if b := img.Bounds(); b.Dx() != testWidth || b.Dy() != testHeight {
+			t.Fatalf("frame %d is %dx%d, want %dx%d", i, b.Dx(), b.Dy(), testWidth, testHeight)
+		}
+	}
+	return sent, received
+}
+
+// colorsClose reports whether two colors are within what lossy encoding
+// and chroma subsampling should change
+func colorsClose(a, b color.RGBA) bool {
+	const tolerance = 0x20
+	near := func(x, y uint8) bool {
+		d := int(x) - int(y)
+		return d >= -tolerance && d <= tolerance
+	}
+	return near(a.R, b.R) && near(a.G, b.G) && near(a.B, b.B)
+}
+
+func TestCaptureBars(t *testing.T) {
+	// The 75% SMPTE bars drawn across the top of the bars pattern
+	bars := []color.RGBA{
+		{0xbf, 0xbf, 0xbf, 0xff},
+		{0xbf, 0xbf, 0x00, 0xff},
+		{0x00, 0xbf, 0xbf, 0xff},
+		{0x00, 0xbf, 0x00, 0xff},
+		{0xbf, 0x00, 0xbf, 0xff},
+		{0xbf, 0x00, 0x00, 0xff},
+		{0x00, 0x00, 0xbf, 0xff},
+	}
+
+	for _, codec := range []vpx.Codec{vpx.VP8, vpx.VP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			_, received := roundTrip(t, "bars", codec)
+
+			for i, img := range received {
+				for j, want := range bars {
+					// Sample the middle of each bar, away from edges that
+					// blur when encoded
+					x := (2*j + 1) * testWidth / (2 * len(bars))
+					y := testHeight * 3 / 8
+					if got := img.RGBAAt(x, y); !colorsClose(got, want) {
+						t.Errorf("frame %d: bar %d is %v, want %v", i, j, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// meanDifference is the average difference in brightness between two
+// pictures of the same size
+func meanDifference(a, b *image.RGBA) float64 {
+	var total float64
+	r := a.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ga := color.GrayModel.Convert(a.RGBAAt(x, y)).(color.Gray).Y
+			gb := color.GrayModel.Convert(b.RGBAAt(x, y)).(color.Gray).Y
+			d := float64(ga) - float64(gb)
+			if d < 0 {
+				d = -d
+			}
+			total += d
+		}
+	}
+	return total / float64(r.Dx()*r.Dy())
+}
+
+func TestCaptureIVF(t *testing.T) {
+	for _, codec := range []vpx.Codec{vpx.VP8, vpx.VP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			sent, received := roundTrip(t, "ivf:testdata/globe.ivf", codec)
+
+			for i, img := range received {
+				if d := meanDifference(sent[i+1], img); d > 8 {
+					t.Errorf("frame %d differs from what was sent by %.1f on average", i, d)
+				}
+			}
+		})
+	}
+}
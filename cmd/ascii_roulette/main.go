@@ -3,25 +3,112 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/dialup-inc/ascii"
+	"github.com/dialup-inc/ascii/camera"
+	"github.com/dialup-inc/ascii/term"
+	"github.com/dialup-inc/ascii/ui"
+	"github.com/dialup-inc/ascii/vpx"
 )
 
 func main() {
 	var (
 		signalerURL = flag.String("signaler-url", "wss://roulette.dialup.com/ws", "host and port of the signaler")
+		room        = flag.String("room", "", "name of a room to meet someone in (default: random match)")
+		interests   = flag.String("interests", "", "comma-separated list of topics you'd like to talk about")
+		cameraID    = flag.Int("camera", 0, "ID of the camera to use, from -list-cameras")
+		listCameras = flag.Bool("list-cameras", false, "print the available cameras and exit")
+		camSource   = flag.String("camera-source", "webcam", "where video comes from: webcam, bars, box, clock, ivf:<file> or images:<dir>")
+		colors      = flag.String("colors", "auto", "terminal color support: 16, 256, truecolor or auto")
+		render      = flag.String("render", "ascii", "how to draw video: ascii, halfblock or braille")
+		dither      = flag.String("dither", "none", "how to dither video: none, floyd-steinberg, bayer or atkinson")
+		ramp        = flag.String("ramp", "short", "characters for brightness: short, long, blocks or a custom string from dark to bright")
+		adjust      = flag.String("adjust", "", "video corrections, e.g. brightness=0.2,contrast=0.5,gamma=0.3,equalize,sharpen,edges,invert")
+		shapes      = flag.Bool("shapes", false, "draw edges with characters that match their shape")
+		mouse       = flag.Bool("mouse", false, "scroll the chat with the mouse wheel (stops the terminal from selecting text)")
+		encoder     = flag.String("encoder", "", "video encoder settings, e.g. codec=vp9,bitrate=400,min-q=4,max-q=56,keyframe-interval=300,cpu-used=8,threads=2,deadline=realtime,end-usage=cbr,error-resilient=true")
 	)
 	flag.Parse()
 
+	if *listCameras {
+		if err := printCameras(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	colorMode, err := term.ParseColorMode(*colors)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	renderMode, err := ui.ParseRenderMode(*render)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ditherMode, err := ui.ParseDither(*dither)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rampChars, err := ui.ParseRamp(*ramp)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	adjustments, err := ui.ParseAdjustments(*adjust)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	ctx := context.Background()
 
 	app, err := ascii.New(*signalerURL)
 	if err != nil {
 		log.Fatal(err)
 	}
+	app.Room = *room
+	app.Camera = *cameraID
+	app.CameraSource = *camSource
+	app.ColorMode = colorMode
+	app.RenderMode = renderMode
+	app.Dither = ditherMode
+	app.Ramp = rampChars
+	app.ShapeMatch = *shapes
+	app.Adjust = adjustments
+	app.Mouse = *mouse
+	app.Encoder, err = vpx.ParseEncoderConfig(*encoder, app.Encoder)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *interests != "" {
+		app.Interests = strings.Split(*interests, ",")
+	}
 
 	if err := app.Run(ctx); err != nil {
 		log.Fatal(err)
 	}
 }
+
+func printCameras() error {
+	devices, err := camera.Devices()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		fmt.Printf("%d: %s\n", d.ID, d.Name)
+		for _, f := range d.Formats {
+			var sizes []string
+			for _, s := range f.Sizes {
+				sizes = append(sizes, fmt.Sprintf("%dx%d", s.Width, s.Height))
+			}
+			fmt.Printf("    %s: %s\n", f.Name, strings.Join(sizes, " "))
+		}
+	}
+	return nil
+}
@@ -2,13 +2,20 @@ package ascii
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"math/rand"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/dialup-inc/ascii/vpx"
 	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 	"github.com/pion/rtp/codecs"
+	"github.com/pion/sdp/v2"
 	"github.com/pion/webrtc/v2"
 	"github.com/pion/webrtc/v2/pkg/media/samplebuilder"
 )
@@ -21,19 +28,47 @@ type DCMessage struct {
 	Payload []byte
 }
 
-func NewConn(config webrtc.Configuration) (*Conn, error) {
+// payloadTypes are the numbers our session descriptions give each codec
+var payloadTypes = map[vpx.Codec]uint8{
+	vpx.VP8: webrtc.DefaultPayloadTypeVP8,
+	vpx.VP9: webrtc.DefaultPayloadTypeVP9,
+}
+
+// NewConn creates a connection that sends video in codec, if our partner
+// supports it
+func NewConn(config webrtc.Configuration, codec vpx.Codec) (*Conn, error) {
+	pt, ok := payloadTypes[codec]
+	if !ok {
+		return nil, fmt.Errorf("can't send %v", codec)
+	}
+
 	conn := &Conn{
+		sendCodec: codec,
+
 		OnPLI:                      func() {},
 		OnFrame:                    func([]byte) {},
 		OnMessage:                  func(string) {},
+		OnTyping:                   func() {},
 		OnBye:                      func() {},
 		OnDataOpen:                 func() {},
 		OnICEConnectionStateChange: func(webrtc.ICEConnectionState) {},
+		OnReceiverReport:           func(rtcp.ReceptionReport) {},
+		OnREMB:                     func(uint64) {},
 	}
 
+	// Codecs are offered in the order they're registered, best first. VP8
+	// stays around for older clients.
 	m := webrtc.MediaEngine{}
-	m.RegisterCodec(webrtc.NewRTPVP8Codec(webrtc.DefaultPayloadTypeVP8, 90000))
-	api := webrtc.NewAPI(webrtc.WithMediaEngine(m))
+	m.RegisterCodec(webrtc.NewRTPCodec(webrtc.RTPCodecTypeVideo, webrtc.VP9, videoClockRate, 0, "", payloadTypes[vpx.VP9], &vp9Payloader{}))
+	m.RegisterCodec(webrtc.NewRTPVP8Codec(payloadTypes[vpx.VP8], videoClockRate))
+
+	// Gather candidates in the background so they can be sent to our partner
+	// as they're found. Signaling servers that can't relay them get them in
+	// the offer/answer once gathering finishes.
+	se := webrtc.SettingEngine{}
+	se.SetTrickle(true)
+
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithSettingEngine(se))
 
 	pc, err := api.NewPeerConnection(config)
 	if err != nil {
@@ -48,14 +83,19 @@ func NewConn(config webrtc.Configuration) (*Conn, error) {
 		return nil, err
 	}
 
-	track, err := pc.NewTrack(webrtc.DefaultPayloadTypeVP8, rand.Uint32(), "video", "roulette")
+	// The track has to exist before negotiating, so it gets the codec we'd
+	// rather send. Capture packetizes frames itself with the payload type
+	// that's negotiated.
+	track, err := pc.NewTrack(pt, rand.Uint32(), "video", "roulette")
 	if err != nil {
 		return nil, err
 	}
-	if _, err := pc.AddTrack(track); err != nil {
+	sender, err := pc.AddTrack(track)
+	if err != nil {
 		return nil, err
 	}
 	conn.SendTrack = track
+	conn.sender = sender
 
 	dc, err := pc.CreateDataChannel("chat", nil)
 	if err != nil {
@@ -74,13 +114,24 @@ type Conn struct {
 	OnPLI                      func()
 	OnFrame                    func([]byte)
 	OnMessage                  func(string)
+	OnTyping                   func()
 	OnICEConnectionStateChange func(webrtc.ICEConnectionState)
 	OnBye                      func()
 	OnDataOpen                 func()
+	// OnReceiverReport is called with our partner's report on the video
+	// we send
+	OnReceiverReport func(rtcp.ReceptionReport)
+	// OnREMB is called with the bitrate, in bits per second, our partner
+	// estimates they can receive
+	OnREMB func(uint64)
 
 	pc        *webrtc.PeerConnection
+	sender    *webrtc.RTPSender
 	recvTrack *webrtc.Track
+	recvCodec vpx.Codec
+	sendCodec vpx.Codec
 	ssrc      uint32
+	recvStats receiveStats
 
 	dc *webrtc.DataChannel
 
@@ -114,8 +165,71 @@ func (c *Conn) readRTCP(recv *webrtc.RTPReceiver) {
 	}
 }
 
+// readSenderRTCP handles our partner's feedback on the video we send
+func (c *Conn) readSenderRTCP() {
+	for {
+		rtcps, err := c.sender.ReadRTCP()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+
+		for _, pkt := range rtcps {
+			switch p := pkt.(type) {
+			case *rtcp.PictureLossIndication:
+				c.OnPLI()
+			case *rtcp.ReceiverReport:
+				for _, r := range p.Reports {
+					if r.SSRC == c.SendTrack.SSRC() {
+						c.OnReceiverReport(r)
+					}
+				}
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				c.OnREMB(p.Bitrate)
+			}
+		}
+	}
+}
+
+// sendReports tells our partner how their video is arriving until done is
+// closed, so they can adjust their bitrate
+func (c *Conn) sendReports(ssrc uint32, done chan struct{}) {
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			rr, estimate, ok := c.recvStats.report(ssrc, now)
+			if !ok {
+				continue
+			}
+
+			c.pc.WriteRTCP([]rtcp.Packet{
+				&rtcp.ReceiverReport{
+					SSRC:    c.SendTrack.SSRC(),
+					Reports: []rtcp.ReceptionReport{rr},
+				},
+				&rtcp.ReceiverEstimatedMaximumBitrate{
+					SenderSSRC: c.SendTrack.SSRC(),
+					Bitrate:    estimate,
+					SSRCs:      []uint32{ssrc},
+				},
+			})
+		}
+	}
+}
+
 func (c *Conn) readRTP(track *webrtc.Track) {
-	builder := samplebuilder.New(rtpAverageFrameWidth*5, &codecs.VP8Packet{})
+	var depacketizer rtp.Depacketizer = &codecs.VP8Packet{}
+	if c.recvCodec == vpx.VP9 {
+		depacketizer = vp9Packet{}
+	}
+	builder := samplebuilder.New(rtpAverageFrameWidth*5, depacketizer)
 
 	for {
 		pkt, err := track.ReadRTP()
@@ -127,6 +241,7 @@ func (c *Conn) readRTP(track *webrtc.Track) {
 			continue
 		}
 
+		c.recvStats.update(pkt, time.Now())
 		builder.Push(pkt)
 
 		for s := builder.Pop(); s != nil; s = builder.Pop() {
@@ -144,8 +259,11 @@ func (c *Conn) onMessage(msg webrtc.DataChannelMessage) {
 	if err := json.Unmarshal(msg.Data, &dcm); err != nil {
 		// TODO
 	}
-	if dcm.Event == "chat" {
+	switch dcm.Event {
+	case "chat":
 		c.OnMessage(string(dcm.Payload))
+	case "typing":
+		c.OnTyping()
 	}
 }
 
@@ -164,6 +282,17 @@ func (c *Conn) SendMessage(m string) error {
 	return c.dc.Send(data)
 }
 
+// SendTyping tells your partner you're typing a message
+func (c *Conn) SendTyping() error {
+	data, err := json.Marshal(DCMessage{
+		Event: "typing",
+	})
+	if err != nil {
+		return err
+	}
+	return c.dc.Send(data)
+}
+
 func (c *Conn) SendPLI() error {
 	if time.Since(c.lastPLI) < 500*time.Millisecond {
 		return nil
@@ -194,6 +323,81 @@ func (c *Conn) SendBye() error {
 	return nil
 }
 
+// RecvCodec returns the codec of the video our partner sends. It's only
+// meaningful once frames have started arriving.
+func (c *Conn) RecvCodec() vpx.Codec {
+	return c.recvCodec
+}
+
+// SendCodec picks the codec to send video in from our partner's session
+// description. SendTrack's codec is used if our partner supports it,
+// otherwise the best codec we have in common. The payload type is our
+// partner's number for the codec.
+func (c *Conn) SendCodec() (vpx.Codec, uint8, error) {
+	desc := c.pc.RemoteDescription()
+	if desc == nil {
+		return 0, 0, errors.New("no remote description")
+	}
+
+	remote, err := videoPayloadTypes(desc.SDP)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, codec := range []vpx.Codec{c.sendCodec, vpx.VP9, vpx.VP8} {
+		if pt, ok := remote[codec]; ok {
+			return codec, pt, nil
+		}
+	}
+	return 0, 0, errors.New("partner doesn't support VP8 or VP9")
+}
+
+// videoPayloadTypes finds the payload types for the codecs we know in the
+// video sections of an SDP
+func videoPayloadTypes(desc string) (map[vpx.Codec]uint8, error) {
+	parsed := &sdp.SessionDescription{}
+	if err := parsed.Unmarshal([]byte(desc)); err != nil {
+		return nil, err
+	}
+
+	types := make(map[vpx.Codec]uint8)
+	for _, m := range parsed.MediaDescriptions {
+		if m.MediaName.Media != "video" {
+			continue
+		}
+
+		// Formats are listed in order of preference, so the first payload
+		// type for a codec is the one to use
+		for _, format := range m.MediaName.Formats {
+			pt, err := strconv.ParseUint(format, 10, 8)
+			if err != nil {
+				continue
+			}
+			codec, err := rtpmapCodec(m, format)
+			if err != nil {
+				continue
+			}
+			if _, ok := types[codec]; !ok {
+				types[codec] = uint8(pt)
+			}
+		}
+	}
+
+	return types, nil
+}
+
+// rtpmapCodec reads the codec a media section's rtpmap gives a payload
+// type, from attributes like "a=rtpmap:96 VP8/90000"
+func rtpmapCodec(m *sdp.MediaDescription, format string) (vpx.Codec, error) {
+	for _, a := range m.Attributes {
+		if a.Key != "rtpmap" || !strings.HasPrefix(a.Value, format+" ") {
+			continue
+		}
+		name := strings.Split(strings.TrimPrefix(a.Value, format+" "), "/")[0]
+		return vpx.ParseCodec(name)
+	}
+	return 0, fmt.Errorf("no rtpmap for payload type %s", format)
+}
+
 func (c *Conn) IsConnected() bool {
 	switch c.pc.ICEConnectionState() {
 	case webrtc.ICEConnectionStateCompleted, webrtc.ICEConnectionStateConnected:
@@ -208,7 +412,16 @@ func (c *Conn) onTrack(track *webrtc.Track, recv *webrtc.RTPReceiver) {
 		return
 	}
 	c.recvTrack = track
+	if codec, err := vpx.ParseCodec(track.Codec().Name); err == nil {
+		c.recvCodec = codec
+	}
 
 	go c.readRTCP(recv)
+	go c.readSenderRTCP()
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.sendReports(track.SSRC(), done)
+
 	c.readRTP(track)
 }
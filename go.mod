@@ -18,6 +18,7 @@ require (
 	github.com/pion/ice v0.5.1 // indirect
 	github.com/pion/rtcp v1.2.1
 	github.com/pion/rtp v1.1.3
+	github.com/pion/sdp/v2 v2.2.0
 	github.com/pion/stun v0.3.1
 	github.com/pion/webrtc/v2 v2.0.24-0.20190715150138-632530bc69a7
 	github.com/prometheus/client_golang v1.0.0 // indirect
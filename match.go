@@ -2,23 +2,70 @@ package ascii
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pion/sdp/v2"
 	"github.com/pion/webrtc/v2"
 )
 
 type signalMsg struct {
-	Type    string                    `json:"type"`
-	Payload webrtc.SessionDescription `json:"payload"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+type recvSignalMsg struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
 }
 
 var errMatchFailed = errors.New("match failed")
 
-func Match(ctx context.Context, wsURL string, conn *webrtc.PeerConnection) error {
-	err := match(ctx, wsURL, conn)
+// MatchOptions describe who you'd like to be matched with
+type MatchOptions struct {
+	// Room is the name of a room to meet in. If it's empty, you're matched
+	// with a random partner from the lobby.
+	Room string
+
+	// Interests are tags you'd like to have in common with your partner.
+	// They're ignored when joining a room.
+	Interests []string
+}
+
+func (o MatchOptions) apply(wsURL string) (string, error) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return "", fmt.Errorf("parse signaler url: %v", err)
+	}
+	q := u.Query()
+	// Tell the server we can trickle candidates. Older servers ignore it.
+	q.Set("trickle", "1")
+	if o.Room != "" {
+		q.Set("room", o.Room)
+	}
+	if len(o.Interests) > 0 {
+		q.Set("interests", strings.Join(o.Interests, ","))
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Match connects to the signaling server at wsURL and negotiates a session
+// with a partner chosen according to opts.
+func Match(ctx context.Context, wsURL string, opts MatchOptions, conn *webrtc.PeerConnection) error {
+	wsURL, err := opts.apply(wsURL)
+	if err != nil {
+		return err
+	}
+
+	err = match(ctx, wsURL, conn)
 	if e, ok := err.(*websocket.CloseError); ok {
 		switch e.Code {
 		case websocket.CloseNormalClosure:
@@ -37,10 +84,10 @@ func Match(ctx context.Context, wsURL string, conn *webrtc.PeerConnection) error
 
 func match(ctx context.Context, wsURL string, conn *webrtc.PeerConnection) error {
 	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
 
 	signalConn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
 	if err != nil {
+		cancel()
 		return fmt.Errorf("match server connect: %v", err)
 	}
 	go func() {
@@ -53,66 +100,297 @@ func match(ctx context.Context, wsURL string, conn *webrtc.PeerConnection) error
 		signalConn.Close()
 	}()
 
-	msg := &signalMsg{}
+	s := &signaler{ws: signalConn, pc: conn, gatherDone: make(chan struct{})}
+	conn.OnICECandidate(s.onICECandidate)
+
+	if err := s.negotiate(ctx); err != nil {
+		cancel()
+		return err
+	}
+
+	// Without trickling, the candidates were in the offer and answer and
+	// the server is about to hang up
+	if !s.trickle {
+		cancel()
+		return nil
+	}
+
+	// Keep exchanging candidates until the caller cancels ctx (usually once
+	// the ICE connection is up) or the signaling server hangs up.
+	go func() {
+		defer cancel()
+		s.addRemoteCandidates(ctx)
+	}()
+
+	return nil
+}
+
+// gatherTimeout is the longest we wait for candidates when they have to
+// go in the offer or answer
+const gatherTimeout = 5 * time.Second
+
+// offerRequest is the payload of requestOffer. Servers that don't relay
+// candidates leave it out.
+type offerRequest struct {
+	// Trickle is set when both sides can trickle candidates
+	Trickle bool `json:"trickle"`
+}
+
+// signalDescription is an offer or answer. Trickle is set on offers whose
+// candidates will follow separately, so the answerer does the same.
+type signalDescription struct {
+	webrtc.SessionDescription
+	Trickle bool `json:"trickle,omitempty"`
+}
+
+// signaler holds the client side of a signaling session
+type signaler struct {
+	ws *websocket.Conn
+	pc *webrtc.PeerConnection
+
+	// trickle is whether candidates are exchanged after the offer and
+	// answer, as decided in negotiate
+	trickle bool
+
+	// mu guards writes to ws along with the candidate queue and gathered
+	// candidates
+	mu        sync.Mutex
+	trickling bool
+	pending   []webrtc.ICECandidateInit
+	gathered  []sdp.ICECandidate
+	// gatherDone is closed once pion has gathered all our candidates
+	gatherDone chan struct{}
+	doneClosed bool
+}
+
+func (s *signaler) send(typ string, payload interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ws.WriteJSON(signalMsg{
+		Type:    typ,
+		Payload: payload,
+	})
+}
+
+// onICECandidate sends local candidates to our partner. Candidates gathered
+// before the offer/answer exchange finishes are queued so they don't get
+// mixed up with the server's handshake.
+func (s *signaler) onICECandidate(c *webrtc.ICECandidate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// pion sends nil once gathering is done
+	if c == nil {
+		if !s.doneClosed {
+			close(s.gatherDone)
+			s.doneClosed = true
+		}
+		return
+	}
+	s.gathered = append(s.gathered, sdpCandidate(c))
+	init := candidateInit(c)
+
+	if !s.trickling {
+		s.pending = append(s.pending, init)
+		return
+	}
+	s.ws.WriteJSON(signalMsg{
+		Type:    "candidate",
+		Payload: init,
+	})
+}
+
+// startTrickle flushes the queued candidates and sends new ones as they're
+// gathered.
+func (s *signaler) startTrickle() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trickling = true
+	for _, c := range s.pending {
+		if err := s.ws.WriteJSON(signalMsg{
+			Type:    "candidate",
+			Payload: c,
+		}); err != nil {
+			return err
+		}
+	}
+	s.pending = nil
+
+	return nil
+}
+
+// withCandidates waits for gathering to finish and adds our candidates to
+// desc, for when they can't be trickled
+func (s *signaler) withCandidates(ctx context.Context, desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	select {
+	case <-s.gatherDone:
+	case <-time.After(gatherTimeout):
+		// Send what we have. It's usually enough.
+	case <-ctx.Done():
+		return desc, ctx.Err()
+	}
+
+	parsed := &sdp.SessionDescription{}
+	if err := parsed.Unmarshal([]byte(desc.SDP)); err != nil {
+		return desc, err
+	}
+
+	s.mu.Lock()
+	for _, m := range parsed.MediaDescriptions {
+		for _, c := range s.gathered {
+			m.WithICECandidate(c)
+		}
+		m.WithPropertyAttribute("end-of-candidates")
+	}
+	s.mu.Unlock()
+
+	out, err := parsed.Marshal()
+	if err != nil {
+		return desc, err
+	}
+	desc.SDP = string(out)
+	return desc, nil
+}
+
+// negotiate performs the offer/answer exchange
+func (s *signaler) negotiate(ctx context.Context) error {
 	for {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		if err := signalConn.ReadJSON(msg); err != nil {
+		var msg recvSignalMsg
+		if err := s.ws.ReadJSON(&msg); err != nil {
 			return err
 		}
 
 		switch msg.Type {
 		case "requestOffer":
-			offer, err := conn.CreateOffer(nil)
+			var req offerRequest
+			if len(msg.Payload) > 0 {
+				if err := json.Unmarshal(msg.Payload, &req); err != nil {
+					return err
+				}
+			}
+			s.trickle = req.Trickle
+
+			offer, err := s.pc.CreateOffer(nil)
 			if err != nil {
 				return err
 			}
-			if err := conn.SetLocalDescription(offer); err != nil {
+			if err := s.pc.SetLocalDescription(offer); err != nil {
 				return err
 			}
-			if err := signalConn.WriteJSON(signalMsg{
-				Type:    "offer",
-				Payload: offer,
-			}); err != nil {
+			if !s.trickle {
+				if offer, err = s.withCandidates(ctx, offer); err != nil {
+					return err
+				}
+			}
+			if err := s.send("offer", signalDescription{offer, s.trickle}); err != nil {
 				return err
 			}
 
 		case "offer":
-			if err := conn.SetRemoteDescription(msg.Payload); err != nil {
+			var offer signalDescription
+			if err := json.Unmarshal(msg.Payload, &offer); err != nil {
+				return err
+			}
+			s.trickle = offer.Trickle
+
+			if err := s.pc.SetRemoteDescription(offer.SessionDescription); err != nil {
 				return err
 			}
-			answer, err := conn.CreateAnswer(nil)
+			answer, err := s.pc.CreateAnswer(nil)
 			if err != nil {
 				return err
 			}
-			if err := conn.SetLocalDescription(answer); err != nil {
+			if err := s.pc.SetLocalDescription(answer); err != nil {
 				return err
 			}
-			if err := signalConn.WriteJSON(signalMsg{
-				Type:    "answer",
-				Payload: answer,
-			}); err != nil {
+			if !s.trickle {
+				if answer, err = s.withCandidates(ctx, answer); err != nil {
+					return err
+				}
+			}
+			if err := s.send("answer", answer); err != nil {
 				return err
 			}
 
-			return nil
+			if !s.trickle {
+				return nil
+			}
+			return s.startTrickle()
+
 		case "answer":
-			if err := conn.SetRemoteDescription(msg.Payload); err != nil {
+			var answer webrtc.SessionDescription
+			if err := json.Unmarshal(msg.Payload, &answer); err != nil {
+				return err
+			}
+			if err := s.pc.SetRemoteDescription(answer); err != nil {
 				return err
 			}
 
-			if err := signalConn.WriteJSON(signalMsg{
-				Type: "answerAck",
-			}); err != nil {
+			if err := s.send("answerAck", nil); err != nil {
 				return err
 			}
 
-			return nil
+			if !s.trickle {
+				return nil
+			}
+			return s.startTrickle()
+
 		default:
 			return fmt.Errorf("unknown signaling message %v", msg.Type)
 		}
+	}
+}
+
+// addRemoteCandidates adds candidates relayed by the signaling server
+func (s *signaler) addRemoteCandidates(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		var msg recvSignalMsg
+		if err := s.ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Type != "candidate" {
+			continue
+		}
+
+		var c webrtc.ICECandidateInit
+		if err := json.Unmarshal(msg.Payload, &c); err != nil {
+			continue
+		}
+
+		// A bad candidate shouldn't stop us from trying the rest
+		s.pc.AddICECandidate(c)
+	}
+}
+
+// candidateInit converts a gathered candidate to the SDP attribute form
+// expected by AddICECandidate on the other side. Our version of pion has
+// no ICECandidate.ToJSON, so this goes through the SDP package pion uses
+// for the candidates in offers and answers.
+func candidateInit(c *webrtc.ICECandidate) webrtc.ICECandidateInit {
+	m := (&sdp.MediaDescription{}).WithICECandidate(sdpCandidate(c))
+	return webrtc.ICECandidateInit{Candidate: *m.Attributes[0].String()}
+}
 
+func sdpCandidate(c *webrtc.ICECandidate) sdp.ICECandidate {
+	return sdp.ICECandidate{
+		Foundation:     c.Foundation,
+		Component:      c.Component,
+		Priority:       c.Priority,
+		Address:        c.Address,
+		Protocol:       c.Protocol.String(),
+		Port:           c.Port,
+		Typ:            c.Typ.String(),
+		RelatedAddress: c.RelatedAddress,
+		RelatedPort:    c.RelatedPort,
 	}
 }
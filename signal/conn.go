@@ -13,6 +13,7 @@ type msgType string
 const (
 	msgTypeAnswer       msgType = "answer"
 	msgTypeAnswerAck    msgType = "answerAck"
+	msgTypeCandidate    msgType = "candidate"
 	msgTypeOffer        msgType = "offer"
 	msgTypeRequestOffer msgType = "requestOffer"
 )
@@ -27,15 +28,39 @@ type connID uint64
 type conn struct {
 	ID connID
 
+	// Interests are the tags the client would like to have in common with
+	// their partner.
+	Interests []string
+	// Joined is when the client connected to the server.
+	Joined time.Time
+	// Trickle is set for clients that can exchange ICE candidates after the
+	// offer and answer. Older clients put them in the offer and answer.
+	Trickle bool
+
 	wsMu sync.Mutex
 	ws   *websocket.Conn
 }
 
-func newConn(id connID, ws *websocket.Conn) *conn {
+func newConn(id connID, ws *websocket.Conn, interests []string) *conn {
 	return &conn{
-		ID: id,
-		ws: ws,
+		ID:        id,
+		Interests: interests,
+		Joined:    time.Now(),
+		ws:        ws,
+	}
+}
+
+// sharedInterests counts the interests c has in common with other
+func (c *conn) sharedInterests(other *conn) int {
+	var n int
+	for _, a := range c.Interests {
+		for _, b := range other.Interests {
+			if a == b {
+				n++
+			}
+		}
 	}
+	return n
 }
 
 func (c *conn) Close(code int, reason string) error {
@@ -47,10 +72,19 @@ func (c *conn) Close(code int, reason string) error {
 	return c.ws.Close()
 }
 
-func (c *conn) RequestOffer() (offer interface{}, err error) {
+// offerRequest tells the offerer to trickle its candidates. It's only sent
+// when both clients can.
+type offerRequest struct {
+	Trickle bool `json:"trickle"`
+}
+
+func (c *conn) RequestOffer(trickle bool) (offer interface{}, err error) {
 	req := msg{
 		Type: msgTypeRequestOffer,
 	}
+	if trickle {
+		req.Payload = offerRequest{Trickle: true}
+	}
 	resp := &msg{
 		Type: msgTypeOffer,
 	}
@@ -94,6 +128,32 @@ func (c *conn) SendAnswer(answer interface{}) error {
 	return nil
 }
 
+// RelayCandidates forwards ICE candidates from c to its partner until c
+// hangs up or sends something else, or the partner can't be reached.
+func (c *conn) RelayCandidates(partner *conn) error {
+	for {
+		var m msg
+		if err := c.ws.ReadJSON(&m); err != nil {
+			return fmt.Errorf("relay read: %v", err)
+		}
+
+		if m.Type != msgTypeCandidate {
+			return fmt.Errorf("relay: expected %q, got %q", msgTypeCandidate, m.Type)
+		}
+
+		if err := partner.send(m); err != nil {
+			return fmt.Errorf("relay write: %v", err)
+		}
+	}
+}
+
+func (c *conn) send(m msg) error {
+	c.wsMu.Lock()
+	defer c.wsMu.Unlock()
+
+	return c.ws.WriteJSON(m)
+}
+
 func (c *conn) rpc(req msg, resp *msg) error {
 	c.wsMu.Lock()
 	defer c.wsMu.Unlock()
@@ -33,6 +33,13 @@ func (l *Group) Remove(id connID) *conn {
 	return c
 }
 
+func (l *Group) Len() int {
+	l.membersMu.Lock()
+	defer l.membersMu.Unlock()
+
+	return len(l.members)
+}
+
 func (l *Group) Pop() []*conn {
 	var members []*conn
 
@@ -4,17 +4,19 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
 	var (
-		port = flag.Int("port", 8080, "http port")
+		port      = flag.Int("port", 8080, "http port")
+		matchWait = flag.Duration("match-wait", 30*time.Second, "how long to look for a partner with shared interests before matching randomly")
 	)
 	flag.Parse()
 
-	srv := NewServer()
+	srv := NewServer(*matchWait)
 
 	log.Info().Int("port", *port).Msg("listening")
 	if err := http.ListenAndServe(fmt.Sprint(":", *port), srv); err != nil {
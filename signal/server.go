@@ -2,8 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"math/rand"
 	"net/http"
+	"regexp"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -33,10 +37,15 @@ var (
 	})
 )
 
-func NewServer() *Server {
+// NewServer creates a signaling server. Clients in the lobby who share
+// interests are matched first; after waiting matchWait they're paired at
+// random instead.
+func NewServer(matchWait time.Duration) *Server {
 	s := &Server{
+		matchWait:   matchWait,
 		active:      NewGroup(),
 		lobby:       NewGroup(),
+		rooms:       map[string]*Group{},
 		promHandler: promhttp.Handler(),
 	}
 	go s.doMatching()
@@ -47,6 +56,11 @@ type Server struct {
 	active *Group
 	lobby  *Group
 
+	roomsMu sync.Mutex
+	rooms   map[string]*Group
+
+	matchWait time.Duration
+
 	nextID connID
 
 	promHandler http.Handler
@@ -78,7 +92,48 @@ func (s *Server) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// room names are limited so they can't be used to exhaust memory
+var roomRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+var interestRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+const maxInterests = 10
+
+// parseInterests reads a comma-separated list of interest tags, normalizing
+// and de-duplicating them.
+func parseInterests(s string) ([]string, error) {
+	var interests []string
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !interestRegex.MatchString(tag) {
+			return nil, errors.New("invalid interest")
+		}
+		seen[tag] = true
+		interests = append(interests, tag)
+	}
+	if len(interests) > maxInterests {
+		return nil, errors.New("too many interests")
+	}
+	return interests, nil
+}
+
 func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
+	room := r.URL.Query().Get("room")
+	if room != "" && !roomRegex.MatchString(room) {
+		http.Error(w, "invalid room name", http.StatusBadRequest)
+		return
+	}
+
+	interests, err := parseInterests(r.URL.Query().Get("interests"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var upgrader websocket.Upgrader
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -88,18 +143,37 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 
 	id := atomic.AddUint64((*uint64)(&s.nextID), 1)
 
-	conn := newConn(connID(id), ws)
+	conn := newConn(connID(id), ws, interests)
+	conn.Trickle = r.URL.Query().Get("trickle") == "1"
 	s.active.Add(conn)
-	s.lobby.Add(conn)
+	if room == "" {
+		s.lobby.Add(conn)
+	} else {
+		s.joinRoom(room, conn)
+	}
 
 	connsActive.Inc()
 	connsStarted.Inc()
 
 	log.Info().
 		Uint64("id", id).
+		Str("room", room).
+		Strs("interests", interests).
 		Msg("new conn")
 }
 
+func (s *Server) joinRoom(name string, c *conn) {
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	room, ok := s.rooms[name]
+	if !ok {
+		room = NewGroup()
+		s.rooms[name] = room
+	}
+	room.Add(c)
+}
+
 func (s *Server) connComplete(c *conn) {
 	log.Info().
 		Uint64("id", uint64(c.ID)).
@@ -127,23 +201,56 @@ func (s *Server) connErr(c *conn, err error) {
 	connsFailed.Inc()
 }
 
-func (s *Server) handshake(a, b *conn) error {
-	offer, err := a.RequestOffer()
+// handshake passes an offer and answer between a and b, reporting whether
+// they'll trickle candidates afterwards
+func (s *Server) handshake(a, b *conn) (trickle bool, err error) {
+	trickle = a.Trickle && b.Trickle
+
+	offer, err := a.RequestOffer(trickle)
 	if err != nil {
-		return err
+		return false, err
 	}
 	answer, err := b.SendOffer(offer)
 	if err != nil {
-		return err
+		return false, err
 	}
 	if err := a.SendAnswer(answer); err != nil {
-		return err
+		return false, err
+	}
+	return trickle, nil
+}
+
+// trickleTimeout is how long to relay ICE candidates between two matched
+// clients before hanging up on them
+const trickleTimeout = 15 * time.Second
+
+// relayCandidates passes ICE candidates between a and b. Clients hang up
+// once they've connected, which can be before their partner has, so each
+// direction keeps going until its sender hangs up.
+func (s *Server) relayCandidates(a, b *conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		a.RelayCandidates(b)
+		done <- struct{}{}
+	}()
+	go func() {
+		b.RelayCandidates(a)
+		done <- struct{}{}
+	}()
+
+	timeout := time.After(trickleTimeout)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-timeout:
+			return
+		}
 	}
-	return nil
 }
 
 func (s *Server) match(a, b *conn) {
-	if err := s.handshake(a, b); err != nil {
+	trickle, err := s.handshake(a, b)
+	if err != nil {
 		s.connErr(a, err)
 		s.connErr(b, err)
 		return
@@ -154,31 +261,129 @@ func (s *Server) match(a, b *conn) {
 		Uint64("b", uint64(b.ID)).
 		Msg("matched conns")
 
+	if trickle {
+		s.relayCandidates(a, b)
+	}
+
 	s.connComplete(a)
 	s.connComplete(b)
 }
 
-// runs in own goroutine
-func (s *Server) doMatching() {
-	ticker := time.NewTicker(5 * time.Second)
-	for range ticker.C {
-		candidates := s.lobby.Pop()
+// matchGroup randomly pairs up the members of g. If there's an odd number
+// of members, the one left over stays in the group for the next round.
+func (s *Server) matchGroup(g *Group) {
+	candidates := g.Pop()
+
+	var partner *conn
+	for _, i := range rand.Perm(len(candidates)) {
+		c := candidates[i]
 
-		var partner *conn
-		for _, i := range rand.Perm(len(candidates)) {
-			c := candidates[i]
+		if partner == nil {
+			partner = c
+			continue
+		}
+
+		go s.match(c, partner)
+		partner = nil
+	}
+
+	if partner != nil {
+		g.Add(partner)
+	}
+}
+
+// matchByInterest pairs up members of g who share the most interests.
+// Members who don't list any interests, or who have waited longer than
+// matchWait without finding someone compatible, are paired at random.
+func (s *Server) matchByInterest(g *Group) {
+	pairs, waiting := s.pairByInterest(g.Pop(), time.Now())
 
-			if partner == nil {
-				partner = c
+	for _, p := range pairs {
+		go s.match(p[0], p[1])
+	}
+	for _, c := range waiting {
+		g.Add(c)
+	}
+}
+
+// pairByInterest decides who to match for matchByInterest, returning the
+// pairs and the members left waiting
+func (s *Server) pairByInterest(candidates []*conn, now time.Time) (pairs [][2]*conn, waiting []*conn) {
+	// Shuffle so ties are broken randomly
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	matched := map[connID]bool{}
+	for i, a := range candidates {
+		if matched[a.ID] {
+			continue
+		}
+
+		var best *conn
+		var bestShared int
+		for _, b := range candidates[i+1:] {
+			if matched[b.ID] {
 				continue
 			}
+			if n := a.sharedInterests(b); n > bestShared {
+				best, bestShared = b, n
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		matched[a.ID] = true
+		matched[best.ID] = true
+		pairs = append(pairs, [2]*conn{a, best})
+	}
+
+	var partner *conn
+	for _, c := range candidates {
+		if matched[c.ID] {
+			continue
+		}
 
-			go s.match(c, partner)
-			partner = nil
+		flexible := len(c.Interests) == 0 || now.Sub(c.Joined) >= s.matchWait
+		if !flexible {
+			waiting = append(waiting, c)
+			continue
 		}
 
-		if partner != nil {
-			s.lobby.Add(partner)
+		if partner == nil {
+			partner = c
+			continue
 		}
+
+		pairs = append(pairs, [2]*conn{c, partner})
+		partner = nil
+	}
+
+	if partner != nil {
+		waiting = append(waiting, partner)
+	}
+	return pairs, waiting
+}
+
+func (s *Server) matchRooms() {
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	for name, room := range s.rooms {
+		s.matchGroup(room)
+
+		if room.Len() == 0 {
+			delete(s.rooms, name)
+		}
+	}
+}
+
+// runs in own goroutine
+func (s *Server) doMatching() {
+	ticker := time.NewTicker(5 * time.Second)
+	for range ticker.C {
+		s.matchByInterest(s.lobby)
+		s.matchRooms()
 	}
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInterests(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"go", []string{"go"}, false},
+		{" Go , rust,,go ", []string{"go", "rust"}, false},
+		{"go,GO, go", []string{"go"}, false},
+		{"sci-fi,board_games", []string{"sci-fi", "board_games"}, false},
+		{"two words", nil, true},
+		{"emoji🙂", nil, true},
+		{strings.Repeat("x", 33), nil, true},
+		{"a,b,c,d,e,f,g,h,i,j", []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}, false},
+		{"a,b,c,d,e,f,g,h,i,j,k", nil, true},
+		// Duplicates don't count towards the limit
+		{"a,b,c,d,e,f,g,h,i,j,a", []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseInterests(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseInterests(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseInterests(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPairByInterest(t *testing.T) {
+	const matchWait = 30 * time.Second
+	now := time.Now()
+
+	type member struct {
+		interests []string
+		waited    time.Duration
+	}
+	tests := []struct {
+		name    string
+		members []member
+		// pairs are the indexes of members matched together, and waiting
+		// are the ones left in the lobby
+		pairs   [][2]int
+		waiting []int
+	}{
+		{
+			name: "shared tags",
+			members: []member{
+				{[]string{"go"}, 0},
+				{[]string{"chess"}, 0},
+				{[]string{"go", "rust"}, 0},
+				{[]string{"chess", "cooking"}, 0},
+			},
+			pairs: [][2]int{{0, 2}, {1, 3}},
+		},
+		{
+			name: "most shared tags win",
+			members: []member{
+				{[]string{"go", "rust", "chess"}, 0},
+				{[]string{"go", "rust", "chess"}, 0},
+			},
+			pairs: [][2]int{{0, 1}},
+		},
+		{
+			name: "no overlap",
+			members: []member{
+				{[]string{"go"}, 0},
+				{[]string{"chess"}, 0},
+			},
+			waiting: []int{0, 1},
+		},
+		{
+			name: "random after the wait",
+			members: []member{
+				{[]string{"go"}, matchWait},
+				{[]string{"chess"}, matchWait + time.Second},
+			},
+			pairs: [][2]int{{0, 1}},
+		},
+		{
+			name: "only one has waited",
+			members: []member{
+				{[]string{"go"}, matchWait},
+				{[]string{"chess"}, matchWait - time.Second},
+			},
+			waiting: []int{0, 1},
+		},
+		{
+			name: "no interests",
+			members: []member{
+				{nil, 0},
+				{nil, 0},
+				{[]string{"go"}, 0},
+			},
+			pairs:   [][2]int{{0, 1}},
+			waiting: []int{2},
+		},
+		{
+			name: "odd one out",
+			members: []member{
+				{nil, 0},
+			},
+			waiting: []int{0},
+		},
+	}
+
+	s := &Server{matchWait: matchWait}
+	for _, tt := range tests {
+		conns := make([]*conn, len(tt.members))
+		index := map[*conn]int{}
+		for i, m := range tt.members {
+			conns[i] = &conn{ID: connID(i), Interests: m.interests, Joined: now.Add(-m.waited)}
+			index[conns[i]] = i
+		}
+
+		// Pairing is random, so try enough times to see different orders
+		for try := 0; try < 20; try++ {
+			pairs, waiting := s.pairByInterest(append([]*conn(nil), conns...), now)
+
+			var gotPairs [][2]int
+			for _, p := range pairs {
+				a, b := index[p[0]], index[p[1]]
+				if a > b {
+					a, b = b, a
+				}
+				gotPairs = append(gotPairs, [2]int{a, b})
+			}
+			sort.Slice(gotPairs, func(i, j int) bool { return gotPairs[i][0] < gotPairs[j][0] })
+
+			var gotWaiting []int
+			for _, c := range waiting {
+				gotWaiting = append(gotWaiting, index[c])
+			}
+			sort.Ints(gotWaiting)
+
+			if !reflect.DeepEqual(gotPairs, tt.pairs) || !reflect.DeepEqual(gotWaiting, tt.waiting) {
+				t.Errorf("%s: paired %v leaving %v, want %v leaving %v", tt.name, gotPairs, gotWaiting, tt.pairs, tt.waiting)
+				break
+			}
+		}
+	}
+}
@@ -54,6 +54,59 @@ func (a *ANSI) Background(c color.Color) (int, error) {
 	return a.Display.Write(cmd)
 }
 
+// ForegroundRGB sets the foreground to a 24-bit color. Only some terminals
+// support this; see DetectColorMode.
+func (a *ANSI) ForegroundRGB(c color.Color) (int, error) {
+	return a.Display.Write(rgbCommand('3', c))
+}
+
+// BackgroundRGB sets the background to a 24-bit color
+func (a *ANSI) BackgroundRGB(c color.Color) (int, error) {
+	return a.Display.Write(rgbCommand('4', c))
+}
+
+func rgbCommand(layer byte, c color.Color) []byte {
+	r, g, b, _ := c.RGBA()
+
+	var cmd []byte
+	cmd = append(cmd, '\033', '[', layer, '8', ';', '2', ';')
+	cmd = strconv.AppendInt(cmd, int64(r>>8), 10)
+	cmd = append(cmd, ';')
+	cmd = strconv.AppendInt(cmd, int64(g>>8), 10)
+	cmd = append(cmd, ';')
+	cmd = strconv.AppendInt(cmd, int64(b>>8), 10)
+	cmd = append(cmd, 'm')
+
+	return cmd
+}
+
+// Foreground16 sets the foreground to the closest of the 16 standard colors
+func (a *ANSI) Foreground16(c color.Color) (int, error) {
+	return a.Display.Write(color16Command(30, c))
+}
+
+// Background16 sets the background to the closest of the 16 standard colors
+func (a *ANSI) Background16(c color.Color) (int, error) {
+	return a.Display.Write(color16Command(40, c))
+}
+
+func color16Command(base int, c color.Color) []byte {
+	index := ANSIPalette16.Index(c)
+
+	// The bright colors have their own range of codes
+	code := base + index
+	if index >= 8 {
+		code = base + 60 + index - 8
+	}
+
+	var cmd []byte
+	cmd = append(cmd, '\033', '[')
+	cmd = strconv.AppendInt(cmd, int64(code), 10)
+	cmd = append(cmd, 'm')
+
+	return cmd
+}
+
 func (a *ANSI) ResizeWindow(rows, cols int) (int, error) {
 	var cmd []byte
 	cmd = append(cmd, '\033', '[', '8', ';')
@@ -93,10 +146,31 @@ func (a *ANSI) BlinkOff() (int, error) {
 	return a.Display.Write([]byte{'\033', '[', '2', '5', 'm'})
 }
 
+func (a *ANSI) Reverse() (int, error) {
+	return a.Display.Write([]byte{'\033', '[', '7', 'm'})
+}
+
+func (a *ANSI) ReverseOff() (int, error) {
+	return a.Display.Write([]byte{'\033', '[', '2', '7', 'm'})
+}
+
+// EnableMouse asks the terminal to report mouse events as SGR escape
+// sequences. We use it to receive scroll wheel events.
+func (a *ANSI) EnableMouse() (int, error) {
+	return a.Display.Write([]byte("\033[?1000h\033[?1006h"))
+}
+
+func (a *ANSI) DisableMouse() (int, error) {
+	return a.Display.Write([]byte("\033[?1006l\033[?1000l"))
+}
+
 func (a *ANSI) Reset() (int, error) {
 	return a.Display.Write([]byte{'\033', 'c'})
 }
 
+// ANSIPalette16 holds the 16 standard ANSI colors
+var ANSIPalette16 = ANSIPalette[:16]
+
 var ANSIPalette = color.Palette{
 	color.RGBA{0x00, 0x00, 0x00, 0xFF},
 	color.RGBA{0x80, 0x00, 0x00, 0xFF},
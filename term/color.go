@@ -0,0 +1,65 @@
+package term
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ColorMode is the range of colors a terminal is able to display
+type ColorMode int
+
+const (
+	// Color256 uses the xterm 256-color palette
+	Color256 ColorMode = iota
+	// Color16 uses the 16 standard ANSI colors
+	Color16
+	// ColorTrue uses 24-bit RGB colors
+	ColorTrue
+)
+
+func (m ColorMode) String() string {
+	switch m {
+	case Color256:
+		return "256"
+	case Color16:
+		return "16"
+	case ColorTrue:
+		return "truecolor"
+	default:
+		return fmt.Sprintf("ColorMode(%d)", int(m))
+	}
+}
+
+// ParseColorMode reads a color mode name, as used in command line flags.
+// "auto" detects the mode from the environment.
+func ParseColorMode(s string) (ColorMode, error) {
+	switch strings.ToLower(s) {
+	case "auto", "":
+		return DetectColorMode(), nil
+	case "16":
+		return Color16, nil
+	case "256":
+		return Color256, nil
+	case "truecolor", "24bit":
+		return ColorTrue, nil
+	default:
+		return 0, fmt.Errorf("unknown color mode %q", s)
+	}
+}
+
+// DetectColorMode guesses what colors the terminal supports based on the
+// COLORTERM and TERM environment variables.
+func DetectColorMode() ColorMode {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return ColorTrue
+	}
+
+	switch os.Getenv("TERM") {
+	case "linux", "ansi", "vt100", "vt220", "cons25":
+		return Color16
+	}
+
+	return Color256
+}
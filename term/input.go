@@ -32,12 +32,17 @@ func makeStdinRaw() error {
 	return nil
 }
 
-func CaptureStdin(onRune func(rune)) error {
+// CaptureStdin puts the terminal in raw mode and decodes the keys pressed,
+// passing each one to onKey.
+func CaptureStdin(onKey func(Key)) error {
 	if err := makeStdinRaw(); err != nil {
 		return err
 	}
 
+	runes := make(chan rune, 64)
 	go func() {
+		defer close(runes)
+
 		reader := bufio.NewReader(os.Stdin)
 		for {
 			r, _, err := reader.ReadRune()
@@ -47,7 +52,21 @@ func CaptureStdin(onRune func(rune)) error {
 			if err != nil {
 				continue
 			}
-			onRune(r)
+			runes <- r
+		}
+	}()
+
+	go func() {
+		dec := &keyDecoder{runes: runes}
+		for {
+			k, err := dec.ReadKey()
+			if err != nil {
+				break
+			}
+			if k.Code == KeyUnknown {
+				continue
+			}
+			onKey(k)
 		}
 	}()
 
@@ -0,0 +1,329 @@
+package term
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// KeyCode identifies which key was pressed
+type KeyCode int
+
+const (
+	// KeyUnknown is an escape sequence we don't understand
+	KeyUnknown KeyCode = iota
+	// KeyRune is an ordinary character, stored in Key.Rune
+	KeyRune
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyEscape
+	KeyInsert
+	KeyDelete
+	KeyUp
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyWheelUp
+	KeyWheelDown
+)
+
+// Modifier is a bit set of the modifier keys held during a keypress
+type Modifier uint8
+
+const (
+	ModShift Modifier = 1 << iota
+	ModAlt
+	ModCtrl
+)
+
+// Key is a single decoded keypress
+type Key struct {
+	Code KeyCode
+	Mod  Modifier
+	// Rune is the character typed when Code is KeyRune. For control
+	// characters it's the lowercase letter that was pressed with ctrl.
+	Rune rune
+}
+
+// IsCtrl reports whether k is ctrl plus the given letter
+func (k Key) IsCtrl(r rune) bool {
+	return k.Code == KeyRune && k.Mod == ModCtrl && k.Rune == r
+}
+
+// IsAlt reports whether k is alt plus the given character
+func (k Key) IsAlt(r rune) bool {
+	return k.Code == KeyRune && k.Mod == ModAlt && k.Rune == r
+}
+
+const esc = '\033'
+
+// escTimeout is how long to wait for the rest of an escape sequence before
+// deciding that the user just pressed Escape
+const escTimeout = 50 * time.Millisecond
+
+var errKeyTimeout = errors.New("timed out waiting for key")
+
+// keyDecoder turns the raw characters read from a terminal into Keys
+type keyDecoder struct {
+	runes <-chan rune
+}
+
+// read returns the next rune. If timeout is nonzero and nothing arrives in
+// time, errKeyTimeout is returned.
+func (d *keyDecoder) read(timeout time.Duration) (rune, error) {
+	if timeout == 0 {
+		r, ok := <-d.runes
+		if !ok {
+			return 0, errors.New("input closed")
+		}
+		return r, nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r, ok := <-d.runes:
+		if !ok {
+			return 0, errors.New("input closed")
+		}
+		return r, nil
+	case <-timer.C:
+		return 0, errKeyTimeout
+	}
+}
+
+func (d *keyDecoder) ReadKey() (Key, error) {
+	c, err := d.read(0)
+	if err != nil {
+		return Key{}, err
+	}
+	if c != esc {
+		return controlKey(c), nil
+	}
+
+	c, err = d.read(escTimeout)
+	if err == errKeyTimeout {
+		return Key{Code: KeyEscape}, nil
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch c {
+	case '[':
+		return d.readCSI()
+	case 'O':
+		return d.readSS3()
+	default:
+		// Terminals send Alt+key as escape followed by the key
+		k := controlKey(c)
+		k.Mod |= ModAlt
+		return k, nil
+	}
+}
+
+// readCSI decodes a Control Sequence Introducer sequence like "ESC [ 1 ; 5 A"
+func (d *keyDecoder) readCSI() (Key, error) {
+	var seq strings.Builder
+	for {
+		c, err := d.read(escTimeout)
+		if err == errKeyTimeout {
+			return Key{Code: KeyUnknown}, nil
+		}
+		if err != nil {
+			return Key{}, err
+		}
+		seq.WriteRune(c)
+
+		// Final bytes are in the range 0x40–0x7E
+		if c >= 0x40 && c <= 0x7E {
+			break
+		}
+	}
+
+	return parseCSI(seq.String()), nil
+}
+
+// readSS3 decodes a Single Shift Three sequence like "ESC O A", which some
+// terminals send for arrows and F1-F4
+func (d *keyDecoder) readSS3() (Key, error) {
+	c, err := d.read(escTimeout)
+	if err == errKeyTimeout {
+		// Alt+O
+		return Key{Code: KeyRune, Mod: ModAlt, Rune: 'O'}, nil
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	if code, ok := finalKeys[c]; ok {
+		return Key{Code: code}, nil
+	}
+	return Key{Code: KeyUnknown}, nil
+}
+
+// controlKey decodes a single character that isn't part of an escape
+// sequence
+func controlKey(c rune) Key {
+	switch c {
+	case '\r', '\n':
+		return Key{Code: KeyEnter}
+	case '\t':
+		return Key{Code: KeyTab}
+	case 127, '\b':
+		return Key{Code: KeyBackspace}
+	case esc:
+		return Key{Code: KeyEscape}
+	}
+
+	// ctrl-a is 0x01, ctrl-b is 0x02, etc
+	if c < 0x20 {
+		return Key{Code: KeyRune, Mod: ModCtrl, Rune: unicode.ToLower(c + '@')}
+	}
+
+	return Key{Code: KeyRune, Rune: c}
+}
+
+// finalKeys maps the last character of CSI and SS3 sequences to keys
+var finalKeys = map[rune]KeyCode{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'H': KeyHome,
+	'F': KeyEnd,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+}
+
+// tildeKeys maps the number in "ESC [ n ~" sequences to keys
+var tildeKeys = map[int]KeyCode{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPageUp,
+	6:  KeyPageDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+}
+
+func parseCSI(seq string) Key {
+	final := rune(seq[len(seq)-1])
+	params := seq[:len(seq)-1]
+
+	if strings.HasPrefix(params, "<") {
+		return parseSGRMouse(params[1:], final)
+	}
+
+	parts := strings.Split(params, ";")
+
+	// xterm encodes modifiers as 1 + a bit set in the second parameter
+	var mod Modifier
+	if len(parts) > 1 {
+		if m, err := strconv.Atoi(parts[1]); err == nil && m > 1 {
+			mod = xtermModifier(m - 1)
+		}
+	}
+
+	if final == 'Z' {
+		return Key{Code: KeyTab, Mod: ModShift}
+	}
+
+	if final == '~' {
+		n, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return Key{Code: KeyUnknown}
+		}
+		if code, ok := tildeKeys[n]; ok {
+			return Key{Code: code, Mod: mod}
+		}
+		return Key{Code: KeyUnknown}
+	}
+
+	if code, ok := finalKeys[final]; ok {
+		return Key{Code: code, Mod: mod}
+	}
+	return Key{Code: KeyUnknown}
+}
+
+func xtermModifier(m int) Modifier {
+	var mod Modifier
+	if m&1 != 0 {
+		mod |= ModShift
+	}
+	if m&2 != 0 || m&8 != 0 {
+		mod |= ModAlt
+	}
+	if m&4 != 0 {
+		mod |= ModCtrl
+	}
+	return mod
+}
+
+// parseSGRMouse decodes mouse reports like "ESC [ < 64 ; x ; y M". We only
+// care about the scroll wheel.
+func parseSGRMouse(params string, final rune) Key {
+	if final != 'M' {
+		return Key{Code: KeyUnknown}
+	}
+
+	button, err := strconv.Atoi(strings.SplitN(params, ";", 2)[0])
+	if err != nil || button&64 == 0 {
+		return Key{Code: KeyUnknown}
+	}
+
+	var mod Modifier
+	if button&4 != 0 {
+		mod |= ModShift
+	}
+	if button&8 != 0 {
+		mod |= ModAlt
+	}
+	if button&16 != 0 {
+		mod |= ModCtrl
+	}
+
+	switch button & 3 {
+	case 0:
+		return Key{Code: KeyWheelUp, Mod: mod}
+	case 1:
+		return Key{Code: KeyWheelDown, Mod: mod}
+	default:
+		return Key{Code: KeyUnknown}
+	}
+}
@@ -0,0 +1,138 @@
+package term
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decodeKeys feeds chunks to a keyDecoder, waiting gap between each like
+// separate reads from the terminal, and returns every key decoded
+func decodeKeys(t *testing.T, gap time.Duration, chunks ...string) []Key {
+	t.Helper()
+
+	runes := make(chan rune)
+	go func() {
+		defer close(runes)
+		for i, c := range chunks {
+			if i > 0 {
+				time.Sleep(gap)
+			}
+			for _, r := range c {
+				runes <- r
+			}
+		}
+	}()
+
+	var keys []Key
+	dec := &keyDecoder{runes: runes}
+	for {
+		k, err := dec.ReadKey()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, k)
+	}
+}
+
+func TestKeyDecoder(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []Key
+	}{
+		// Plain characters
+		{"a", []Key{{Code: KeyRune, Rune: 'a'}}},
+		{"é世", []Key{{Code: KeyRune, Rune: 'é'}, {Code: KeyRune, Rune: '世'}}},
+		{"\r", []Key{{Code: KeyEnter}}},
+		{"\t", []Key{{Code: KeyTab}}},
+		{"\x7f", []Key{{Code: KeyBackspace}}},
+		{"\x01", []Key{{Code: KeyRune, Mod: ModCtrl, Rune: 'a'}}},
+		{"\x17", []Key{{Code: KeyRune, Mod: ModCtrl, Rune: 'w'}}},
+
+		// CSI
+		{"\033[A", []Key{{Code: KeyUp}}},
+		{"\033[D", []Key{{Code: KeyLeft}}},
+		{"\033[H", []Key{{Code: KeyHome}}},
+		{"\033[1;5C", []Key{{Code: KeyRight, Mod: ModCtrl}}},
+		{"\033[1;3D", []Key{{Code: KeyLeft, Mod: ModAlt}}},
+		{"\033[1;2A", []Key{{Code: KeyUp, Mod: ModShift}}},
+		{"\033[5~", []Key{{Code: KeyPageUp}}},
+		{"\033[3~", []Key{{Code: KeyDelete}}},
+		{"\033[15;2~", []Key{{Code: KeyF5, Mod: ModShift}}},
+		{"\033[24~", []Key{{Code: KeyF12}}},
+		{"\033[Z", []Key{{Code: KeyTab, Mod: ModShift}}},
+		{"\033[99~", []Key{{Code: KeyUnknown}}},
+		{"\033[Ab", []Key{{Code: KeyUp}, {Code: KeyRune, Rune: 'b'}}},
+
+		// SS3
+		{"\033OA", []Key{{Code: KeyUp}}},
+		{"\033OP", []Key{{Code: KeyF1}}},
+		{"\033OS", []Key{{Code: KeyF4}}},
+		{"\033Oz", []Key{{Code: KeyUnknown}}},
+
+		// Alt sends escape then the key
+		{"\033a", []Key{{Code: KeyRune, Mod: ModAlt, Rune: 'a'}}},
+		{"\033\x7f", []Key{{Code: KeyBackspace, Mod: ModAlt}}},
+		{"\033\r", []Key{{Code: KeyEnter, Mod: ModAlt}}},
+
+		// SGR mouse
+		{"\033[<64;10;5M", []Key{{Code: KeyWheelUp}}},
+		{"\033[<65;10;5M", []Key{{Code: KeyWheelDown}}},
+		{"\033[<80;1;1M", []Key{{Code: KeyWheelUp, Mod: ModCtrl}}},
+		{"\033[<69;1;1M", []Key{{Code: KeyWheelDown, Mod: ModShift}}},
+		{"\033[<0;1;1M", []Key{{Code: KeyUnknown}}},
+		{"\033[<64;1;1m", []Key{{Code: KeyUnknown}}},
+	}
+
+	for _, tt := range tests {
+		if got := decodeKeys(t, 0, tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decoding %q = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestKeyDecoderSplitReads(t *testing.T) {
+	// Well inside escTimeout, so the pieces belong together
+	const gap = escTimeout / 5
+
+	tests := []struct {
+		chunks []string
+		want   []Key
+	}{
+		{[]string{"\033", "[A"}, []Key{{Code: KeyUp}}},
+		{[]string{"\033[1;", "5", "C"}, []Key{{Code: KeyRight, Mod: ModCtrl}}},
+		{[]string{"\033", "O", "Q"}, []Key{{Code: KeyF2}}},
+		{[]string{"\033[<6", "4;10;", "5M"}, []Key{{Code: KeyWheelUp}}},
+		{[]string{"\033", "a"}, []Key{{Code: KeyRune, Mod: ModAlt, Rune: 'a'}}},
+	}
+
+	for _, tt := range tests {
+		if got := decodeKeys(t, gap, tt.chunks...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decoding %q = %+v, want %+v", tt.chunks, got, tt.want)
+		}
+	}
+}
+
+func TestKeyDecoderTimeout(t *testing.T) {
+	// Long enough that the decoder gives up on the sequence
+	const gap = escTimeout * 3
+
+	tests := []struct {
+		chunks []string
+		want   []Key
+	}{
+		// A lone escape is the Escape key
+		{[]string{"\033", "x"}, []Key{{Code: KeyEscape}, {Code: KeyRune, Rune: 'x'}}},
+		{[]string{"\033", "\033", "y"}, []Key{{Code: KeyEscape}, {Code: KeyEscape}, {Code: KeyRune, Rune: 'y'}}},
+		// "ESC O" on its own is Alt+O
+		{[]string{"\033O", "A"}, []Key{{Code: KeyRune, Mod: ModAlt, Rune: 'O'}, {Code: KeyRune, Rune: 'A'}}},
+		// An unfinished CSI sequence is dropped
+		{[]string{"\033[1;", "A"}, []Key{{Code: KeyUnknown}, {Code: KeyRune, Rune: 'A'}}},
+	}
+
+	for _, tt := range tests {
+		if got := decodeKeys(t, gap, tt.chunks...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decoding %q = %+v, want %+v", tt.chunks, got, tt.want)
+		}
+	}
+}
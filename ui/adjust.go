@@ -0,0 +1,303 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Adjustments are corrections applied to video before it's converted to
+// characters. Contrast and Gamma scale by 1 plus their value, so the zero
+// value leaves images unchanged.
+type Adjustments struct {
+	// Brightness is added to every pixel, from -1 to 1
+	Brightness float64
+	Contrast   float64
+	Gamma      float64
+
+	// Equalize spreads the brightness of the image over the full range
+	Equalize    bool
+	Sharpen     bool
+	EdgeEnhance bool
+	Invert      bool
+}
+
+// Steps and limits for adjusting values with the keyboard
+const (
+	brightnessStep = 0.05
+	contrastStep   = 0.1
+	gammaStep      = 0.1
+
+	minScale = -0.9
+	maxScale = 3
+)
+
+// AdjustToggle names one of the on/off adjustments
+type AdjustToggle int
+
+const (
+	ToggleEqualize AdjustToggle = iota
+	ToggleSharpen
+	ToggleEdgeEnhance
+	ToggleInvert
+)
+
+// ParseAdjustments reads adjustments from a comma-separated list like
+// "brightness=0.2,gamma=-0.1,equalize", as used in command line flags
+func ParseAdjustments(s string) (Adjustments, error) {
+	var adj Adjustments
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		parts := strings.SplitN(field, "=", 2)
+		name := strings.ToLower(parts[0])
+
+		if len(parts) == 1 {
+			switch name {
+			case "equalize":
+				adj.Equalize = true
+			case "sharpen":
+				adj.Sharpen = true
+			case "edges":
+				adj.EdgeEnhance = true
+			case "invert":
+				adj.Invert = true
+			default:
+				return Adjustments{}, fmt.Errorf("unknown adjustment %q", name)
+			}
+			continue
+		}
+
+		v, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return Adjustments{}, fmt.Errorf("invalid value for %s: %v", name, err)
+		}
+		switch name {
+		case "brightness":
+			adj.Brightness = clampFloat(v, -1, 1)
+		case "contrast":
+			adj.Contrast = clampFloat(v, minScale, maxScale)
+		case "gamma":
+			adj.Gamma = clampFloat(v, minScale, maxScale)
+		default:
+			return Adjustments{}, fmt.Errorf("unknown adjustment %q", name)
+		}
+	}
+
+	return adj, nil
+}
+
+// String describes the adjustments in the form ParseAdjustments reads
+func (a Adjustments) String() string {
+	fields := []string{
+		fmt.Sprintf("brightness=%+.2f", a.Brightness),
+		fmt.Sprintf("contrast=%+.1f", a.Contrast),
+		fmt.Sprintf("gamma=%+.1f", a.Gamma),
+	}
+	if a.Equalize {
+		fields = append(fields, "equalize")
+	}
+	if a.Sharpen {
+		fields = append(fields, "sharpen")
+	}
+	if a.EdgeEnhance {
+		fields = append(fields, "edges")
+	}
+	if a.Invert {
+		fields = append(fields, "invert")
+	}
+	return strings.Join(fields, ",")
+}
+
+// step moves v by n steps, keeping it a multiple of the step size
+func step(v float64, n int, size, min, max float64) float64 {
+	v = math.Round(v/size+float64(n)) * size
+	return clampFloat(v, min, max)
+}
+
+func clampFloat(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+// Filter changes an image in place
+type Filter interface {
+	Apply(img *image.RGBA)
+}
+
+// Filters builds the steps needed to make the adjustments
+func (a Adjustments) Filters() []Filter {
+	var filters []Filter
+
+	if a.Equalize {
+		filters = append(filters, equalize{})
+	}
+	if a.Brightness != 0 || a.Contrast != 0 || a.Gamma != 0 {
+		filters = append(filters, toneCurve(a.Brightness, a.Contrast, a.Gamma))
+	}
+	if a.Sharpen {
+		filters = append(filters, sharpenKernel)
+	}
+	if a.EdgeEnhance {
+		filters = append(filters, edgeEnhanceKernel)
+	}
+	if a.Invert {
+		filters = append(filters, invertCurve)
+	}
+
+	return filters
+}
+
+// Apply returns an adjusted copy of img, or img itself if there's nothing
+// to do
+func (a Adjustments) Apply(img image.Image) image.Image {
+	if img == nil {
+		return nil
+	}
+
+	filters := a.Filters()
+	if len(filters) == 0 {
+		return img
+	}
+
+	rect := img.Bounds()
+	out := image.NewRGBA(rect)
+	draw.Draw(out, rect, img, rect.Min, draw.Src)
+
+	for _, f := range filters {
+		f.Apply(out)
+	}
+	return out
+}
+
+// curve maps every color channel value to a new one
+type curve [256]uint8
+
+func (c *curve) Apply(img *image.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = c[img.Pix[i]]
+		img.Pix[i+1] = c[img.Pix[i+1]]
+		img.Pix[i+2] = c[img.Pix[i+2]]
+	}
+}
+
+func toneCurve(brightness, contrast, gamma float64) *curve {
+	var c curve
+	for i := range c {
+		v := float64(i)/0xff + brightness
+		v = (v-0.5)*(1+contrast) + 0.5
+		v = math.Pow(clampFloat(v, 0, 1), 1/(1+gamma))
+		c[i] = clampByte(v * 0xff)
+	}
+	return &c
+}
+
+var invertCurve = func() *curve {
+	var c curve
+	for i := range c {
+		c[i] = uint8(0xff - i)
+	}
+	return &c
+}()
+
+// equalize spreads out the brightness histogram so that each level is used
+// about as often, which brings out detail in dim or washed out video
+type equalize struct{}
+
+func (equalize) Apply(img *image.RGBA) {
+	var hist [256]int
+	for i := 0; i < len(img.Pix); i += 4 {
+		hist[luma(img.Pix[i], img.Pix[i+1], img.Pix[i+2])]++
+	}
+
+	total := len(img.Pix) / 4
+	if total == 0 {
+		return
+	}
+
+	// Map each level to its position in the cumulative histogram, ignoring
+	// the darkest level so black borders don't skew the result
+	var c curve
+	var sum int
+	first := hist[0]
+	for i, n := range hist {
+		sum += n
+		if total == first {
+			c[i] = uint8(i)
+			continue
+		}
+		c[i] = clampByte(float64(sum-first) / float64(total-first) * 0xff)
+	}
+	c.Apply(img)
+}
+
+func luma(r, g, b uint8) uint8 {
+	return uint8((299*int(r) + 587*int(g) + 114*int(b)) / 1000)
+}
+
+// kernel is a 3x3 convolution
+type kernel struct {
+	weights [9]float64
+	scale   float64
+}
+
+var sharpenKernel = &kernel{
+	weights: [9]float64{
+		-2, -2, -2,
+		-2, 32, -2,
+		-2, -2, -2,
+	},
+	scale: 1.0 / 16,
+}
+
+var edgeEnhanceKernel = &kernel{
+	weights: [9]float64{
+		-1, -1, -1,
+		-1, 10, -1,
+		-1, -1, -1,
+	},
+	scale: 1.0 / 2,
+}
+
+func (k *kernel) Apply(img *image.RGBA) {
+	rect := img.Rect
+	w, h := rect.Dx(), rect.Dy()
+	src := make([]uint8, len(img.Pix))
+	copy(src, img.Pix)
+
+	at := func(x, y, ch int) float64 {
+		if x < 0 {
+			x = 0
+		}
+		if x >= w {
+			x = w - 1
+		}
+		if y < 0 {
+			y = 0
+		}
+		if y >= h {
+			y = h - 1
+		}
+		return float64(src[y*img.Stride+x*4+ch])
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for ch := 0; ch < 3; ch++ {
+				var sum float64
+				for ky := 0; ky < 3; ky++ {
+					for kx := 0; kx < 3; kx++ {
+						sum += at(x+kx-1, y+ky-1, ch) * k.weights[ky*3+kx]
+					}
+				}
+				img.Pix[y*img.Stride+x*4+ch] = clampByte(sum * k.scale)
+			}
+		}
+	}
+}
@@ -2,76 +2,338 @@ package ui
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"strings"
 
 	"github.com/dialup-inc/ascii/term"
 	"github.com/nfnt/resize"
 )
 
-var chars = []byte(" .,:;i1tfLCG08@")
+// RenderMode selects how pixels are mapped to characters
+type RenderMode int
 
-func Image2ANSI(img image.Image, cols, rows int, aspect float64, lightBackground bool) []byte {
-	buf := bytes.NewBuffer(nil)
-	a := term.ANSI{buf}
+const (
+	// RenderASCII draws one pixel per character, picking a character from
+	// the brightness ramp
+	RenderASCII RenderMode = iota
+	// RenderHalfBlock draws two pixels per character using the upper half
+	// block with separate foreground and background colors
+	RenderHalfBlock
+	// RenderBraille draws a 2x4 grid of black and white pixels per
+	// character using braille dots
+	RenderBraille
+
+	numRenderModes
+)
+
+// Next returns the render mode after m, wrapping around after the last one
+func (m RenderMode) Next() RenderMode {
+	return (m + 1) % numRenderModes
+}
+
+func (m RenderMode) String() string {
+	switch m {
+	case RenderASCII:
+		return "ascii"
+	case RenderHalfBlock:
+		return "halfblock"
+	case RenderBraille:
+		return "braille"
+	default:
+		return fmt.Sprintf("RenderMode(%d)", int(m))
+	}
+}
+
+// ParseRenderMode reads a render mode name, as used in command line flags
+func ParseRenderMode(s string) (RenderMode, error) {
+	switch strings.ToLower(s) {
+	case "ascii", "":
+		return RenderASCII, nil
+	case "halfblock":
+		return RenderHalfBlock, nil
+	case "braille":
+		return RenderBraille, nil
+	default:
+		return 0, fmt.Errorf("unknown render mode %q", s)
+	}
+}
+
+// RenderOptions control how images are converted to ANSI art
+type RenderOptions struct {
+	Mode RenderMode
+
+	// ColorMode is the range of colors the terminal can display
+	ColorMode term.ColorMode
+
+	// Ramp is the characters used for brightness in ASCII mode. It
+	// defaults to RampShort.
+	Ramp Ramp
+
+	// ShapeMatch draws edges in ASCII mode with the characters whose
+	// shapes best follow them
+	ShapeMatch bool
+
+	// Adjust corrects the image before it's drawn
+	Adjust Adjustments
+
+	// Dither spreads out the error from reducing the image to the terminal's
+	// colors and characters
+	Dither Dither
+
+	// LightBackground inverts the brightness of the characters for
+	// terminals with dark text on a light background
+	LightBackground bool
+}
 
+func Image2ANSI(img image.Image, cols, rows int, aspect float64, opts RenderOptions) []byte {
 	// FIXME: Work around panic in resize when image is too small
 	if rows < 2 || cols < 2 {
 		return nil
 	}
 
-	colors := term.ANSIPalette
-	canvasRect := image.Rect(0, 0, cols, rows)
-	canvas := image.NewPaletted(canvasRect, colors)
-
-	// If there's an image, resize to fit inside canvas dimensions...
-	if img != nil {
-		imgRect := img.Bounds()
-		imgW, imgH := float64(imgRect.Dx())*aspect, float64(imgRect.Dy())
-		fitW, fitH := float64(cols)/imgW, float64(rows)/imgH
-
-		var scaleW, scaleH uint
-		if fitW < fitH {
-			scaleW = uint(imgW * fitW)
-			scaleH = uint(imgH * fitW)
-		} else {
-			scaleW = uint(imgW * fitH)
-			scaleH = uint(imgH * fitH)
-		}
+	img = opts.Adjust.Apply(img)
+
+	switch opts.Mode {
+	case RenderHalfBlock:
+		return drawHalfBlocks(img, cols, rows, aspect, opts)
+	case RenderBraille:
+		return drawBraille(img, cols, rows, aspect, opts)
+	default:
+		return drawASCII(img, cols, rows, aspect, opts)
+	}
+}
+
+// newCanvas creates a black image to draw into
+func newCanvas(w, h int) *image.RGBA {
+	rect := image.Rect(0, 0, w, h)
+	canvas := image.NewRGBA(rect)
+	draw.Draw(canvas, rect, image.Black, image.ZP, draw.Src)
+	return canvas
+}
+
+// quantize limits the colors of canvas to what the terminal can display
+func quantize(canvas *image.RGBA, opts RenderOptions) image.Image {
+	switch opts.ColorMode {
+	case term.ColorTrue:
+		return canvas
+	case term.Color16:
+		return ditherPalette(canvas, term.ANSIPalette16, opts.Dither)
+	default:
+		return ditherPalette(canvas, term.ANSIPalette, opts.Dither)
+	}
+}
+
+func toGray(img image.Image) *image.Gray {
+	gray := image.NewGray(img.Bounds())
+	draw.Draw(gray, gray.Rect, img, gray.Rect.Min, draw.Src)
+	return gray
+}
+
+// drawFitted scales img to fit inside canvas, centering it. aspect is the
+// ratio of the height of canvas pixels to their width.
+func drawFitted(canvas draw.Image, img image.Image, aspect float64) {
+	if img == nil {
+		return
+	}
+
+	canvasRect := canvas.Bounds()
+	cols, rows := canvasRect.Dx(), canvasRect.Dy()
+
+	imgRect := img.Bounds()
+	imgW, imgH := float64(imgRect.Dx())*aspect, float64(imgRect.Dy())
+	fitW, fitH := float64(cols)/imgW, float64(rows)/imgH
+
+	var scaleW, scaleH uint
+	if fitW < fitH {
+		scaleW = uint(imgW * fitW)
+		scaleH = uint(imgH * fitW)
+	} else {
+		scaleW = uint(imgW * fitH)
+		scaleH = uint(imgH * fitH)
+	}
+
+	scaled := resize.Resize(scaleW, scaleH, img, resize.Bilinear)
+
+	offsetW, offsetH := (cols-int(scaleW))/2, (rows-int(scaleH))/2
+	fitRect := image.Rect(
+		offsetW,
+		offsetH,
+		offsetW+int(scaleW),
+		offsetH+int(scaleH),
+	)
+	draw.Draw(canvas, fitRect, scaled, image.ZP, draw.Over)
+}
 
-		scaled := resize.Resize(scaleW, scaleH, img, resize.Bilinear)
+func drawASCII(img image.Image, cols, rows int, aspect float64, opts RenderOptions) []byte {
+	buf := bytes.NewBuffer(nil)
+	a := term.ANSI{buf}
+
+	canvas := newCanvas(cols, rows)
+	drawFitted(canvas, img, aspect)
+
+	ramp := opts.Ramp.orDefault()
+	colors := quantize(canvas, opts)
+	// Without dithering, characters come from the brightness of the color
+	// they're drawn in
+	var levels []int
+	if opts.Dither != DitherNone {
+		levels = ditherLevels(toGray(canvas), len(ramp), opts.Dither)
+	}
 
-		offsetW, offsetH := (cols-int(scaleW))/2, (rows-int(scaleH))/2
-		fitRect := image.Rect(
-			offsetW,
-			offsetH,
-			offsetW+int(scaleW),
-			offsetH+int(scaleH),
-		)
-		draw.Draw(canvas, fitRect, scaled, image.ZP, draw.Over)
+	var shapes []rune
+	if opts.ShapeMatch {
+		detail := image.NewGray(image.Rect(0, 0, cols*glyphSize, rows*glyphSize))
+		drawFitted(detail, img, aspect)
+		shapes = matchGlyphs(detail, cols, rows)
 	}
 
 	// Draw a character and colored ANSI escape sequence for each pixel...
-	currentColor := -1
-	for _, p := range canvas.Pix {
-		pxColor := colors[p]
+	var currentColor color.Color
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			pxColor := colors.At(x, y)
 
-		if int(p) != currentColor {
-			a.Foreground(pxColor)
+			if pxColor != currentColor {
+				setForeground(&a, opts.ColorMode, pxColor)
 
-			currentColor = int(p)
+				currentColor = pxColor
+			}
+
+			if shapes != nil && shapes[y*cols+x] != 0 {
+				buf.WriteRune(shapes[y*cols+x])
+				continue
+			}
+
+			var chr int
+			if levels != nil {
+				chr = levels[y*cols+x]
+			} else {
+				k, _, _, _ := color.GrayModel.Convert(pxColor).RGBA()
+				chr = int(k) * (len(ramp) - 1) / 0xffff
+			}
+			if opts.LightBackground {
+				chr = len(ramp) - chr - 1
+			}
+
+			buf.WriteRune(ramp[chr])
 		}
+	}
+
+	return buf.Bytes()
+}
+
+// upperHalfBlock is drawn with the top pixel as its foreground color and the
+// bottom pixel as its background color
+const upperHalfBlock = "▀"
+
+func drawHalfBlocks(img image.Image, cols, rows int, aspect float64, opts RenderOptions) []byte {
+	buf := bytes.NewBuffer(nil)
+	a := term.ANSI{buf}
+
+	// Each character holds two pixels stacked vertically, so they're
+	// half as tall
+	canvas := newCanvas(cols, rows*2)
+	drawFitted(canvas, img, aspect/2)
+	colors := quantize(canvas, opts)
+
+	var currentFg, currentBg color.Color
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			top := colors.At(x, y*2)
+			bottom := colors.At(x, y*2+1)
 
-		k, _, _, _ := color.GrayModel.Convert(pxColor).RGBA()
-		chr := int(k) * (len(chars) - 1) / 0xffff
+			if top != currentFg {
+				setForeground(&a, opts.ColorMode, top)
+				currentFg = top
+			}
+			if bottom != currentBg {
+				setBackground(&a, opts.ColorMode, bottom)
+				currentBg = bottom
+			}
 
-		if lightBackground {
-			chr = len(chars) - chr - 1
+			buf.WriteString(upperHalfBlock)
 		}
+	}
+
+	return buf.Bytes()
+}
+
+// brailleDots holds the bit for each dot in a braille character, indexed
+// by its position in the 2x4 grid
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+const brailleBlank = 0x2800
+
+func drawBraille(img image.Image, cols, rows int, aspect float64, opts RenderOptions) []byte {
+	buf := bytes.NewBuffer(nil)
+	a := term.ANSI{buf}
+
+	// Each character holds a grid of pixels 2 wide and 4 tall, so
+	// they're half as tall relative to their width
+	w, h := cols*2, rows*4
+	rect := image.Rect(0, 0, w, h)
+
+	gray := image.NewGray(rect)
+	drawFitted(gray, img, aspect/2)
 
-		buf.WriteByte(chars[chr])
+	// Reduce to black and white. Dithering keeps detail in smooth gradients.
+	bw := ditherLevels(gray, 2, opts.Dither)
+
+	// Dots are drawn in the foreground color, so light backgrounds get
+	// the dark pixels
+	lit := 1
+	if opts.LightBackground {
+		lit = 0
+	}
+
+	setForeground(&a, opts.ColorMode, color.White)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			chr := rune(brailleBlank)
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					if bw[(y*4+dy)*w+x*2+dx] == lit {
+						chr |= brailleDots[dy][dx]
+					}
+				}
+			}
+			buf.WriteRune(chr)
+		}
 	}
 
 	return buf.Bytes()
 }
+
+// setForeground changes the text color using the escape codes supported in
+// the given color mode
+func setForeground(a *term.ANSI, mode term.ColorMode, c color.Color) {
+	switch mode {
+	case term.ColorTrue:
+		a.ForegroundRGB(c)
+	case term.Color16:
+		a.Foreground16(c)
+	default:
+		a.Foreground(c)
+	}
+}
+
+// setBackground changes the background color using the escape codes
+// supported in the given color mode
+func setBackground(a *term.ANSI, mode term.ColorMode, c color.Color) {
+	switch mode {
+	case term.ColorTrue:
+		a.BackgroundRGB(c)
+	case term.Color16:
+		a.Background16(c)
+	default:
+		a.Background(c)
+	}
+}
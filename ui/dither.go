@@ -0,0 +1,224 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Dither selects how colors and brightness are spread between the levels
+// the terminal can show
+type Dither int
+
+const (
+	// DitherNone rounds each pixel to the nearest level
+	DitherNone Dither = iota
+	// DitherFloydSteinberg diffuses the rounding error to neighboring pixels
+	DitherFloydSteinberg
+	// DitherBayer adds a repeating threshold pattern, which doesn't shimmer
+	// as much as error diffusion when the video moves
+	DitherBayer
+	// DitherAtkinson diffuses only part of the error, which keeps more
+	// contrast than Floyd–Steinberg
+	DitherAtkinson
+
+	numDithers
+)
+
+// Next returns the dither after d, wrapping around after the last one
+func (d Dither) Next() Dither {
+	return (d + 1) % numDithers
+}
+
+func (d Dither) String() string {
+	switch d {
+	case DitherNone:
+		return "none"
+	case DitherFloydSteinberg:
+		return "floyd-steinberg"
+	case DitherBayer:
+		return "bayer"
+	case DitherAtkinson:
+		return "atkinson"
+	default:
+		return fmt.Sprintf("Dither(%d)", int(d))
+	}
+}
+
+// ParseDither reads a dither name, as used in command line flags
+func ParseDither(s string) (Dither, error) {
+	switch strings.ToLower(s) {
+	case "none", "":
+		return DitherNone, nil
+	case "floyd-steinberg", "fs":
+		return DitherFloydSteinberg, nil
+	case "bayer":
+		return DitherBayer, nil
+	case "atkinson":
+		return DitherAtkinson, nil
+	default:
+		return 0, fmt.Errorf("unknown dither %q", s)
+	}
+}
+
+// diffusion is an error diffusion kernel. Each entry gets weight times the
+// error of the current pixel.
+type diffusion []struct {
+	dx, dy int
+	weight float64
+}
+
+var floydSteinberg = diffusion{
+	{1, 0, 7.0 / 16},
+	{-1, 1, 3.0 / 16},
+	{0, 1, 5.0 / 16},
+	{1, 1, 1.0 / 16},
+}
+
+var atkinson = diffusion{
+	{1, 0, 1.0 / 8},
+	{2, 0, 1.0 / 8},
+	{-1, 1, 1.0 / 8},
+	{0, 1, 1.0 / 8},
+	{1, 1, 1.0 / 8},
+	{0, 2, 1.0 / 8},
+}
+
+func (d Dither) kernel() diffusion {
+	switch d {
+	case DitherFloydSteinberg:
+		return floydSteinberg
+	case DitherAtkinson:
+		return atkinson
+	default:
+		return nil
+	}
+}
+
+var bayer4x4 = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// bayerOffset is the threshold for pixel (x, y), between -0.5 and 0.5
+func bayerOffset(x, y int) float64 {
+	return (bayer4x4[y%4][x%4]+0.5)/16 - 0.5
+}
+
+// ditherLevels maps the brightness of each pixel of img to one of n
+// levels, returning them in row order
+func ditherLevels(img *image.Gray, n int, d Dither) []int {
+	rect := img.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	max := float64(n - 1)
+
+	values := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			values[y*w+x] = float64(img.GrayAt(rect.Min.X+x, rect.Min.Y+y).Y) / 0xff * max
+		}
+	}
+
+	kernel := d.kernel()
+	levels := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := values[y*w+x]
+			if d == DitherBayer {
+				v += bayerOffset(x, y)
+			}
+
+			level := int(v + 0.5)
+			if level < 0 {
+				level = 0
+			}
+			if level > n-1 {
+				level = n - 1
+			}
+			levels[y*w+x] = level
+
+			err := values[y*w+x] - float64(level)
+			for _, k := range kernel {
+				kx, ky := x+k.dx, y+k.dy
+				if kx >= 0 && kx < w && ky < h {
+					values[ky*w+kx] += err * k.weight
+				}
+			}
+		}
+	}
+
+	return levels
+}
+
+// bayerSpread is how far apart, in 8-bit units, colors in a palette are
+// assumed to be when adding the Bayer threshold
+func bayerSpread(p color.Palette) float64 {
+	if len(p) <= 16 {
+		return 0x80
+	}
+	return 0x30
+}
+
+// ditherPalette reduces img to the colors in p
+func ditherPalette(img *image.RGBA, p color.Palette, d Dither) *image.Paletted {
+	rect := img.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	out := image.NewPaletted(rect, p)
+
+	values := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.RGBAAt(rect.Min.X+x, rect.Min.Y+y)
+			values[y*w+x] = [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+		}
+	}
+
+	kernel := d.kernel()
+	spread := bayerSpread(p)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := values[y*w+x]
+			want := v
+			if d == DitherBayer {
+				offset := bayerOffset(x, y) * spread
+				for i := range want {
+					want[i] += offset
+				}
+			}
+
+			index := p.Index(color.RGBA{clampByte(want[0]), clampByte(want[1]), clampByte(want[2]), 0xff})
+			out.SetColorIndex(rect.Min.X+x, rect.Min.Y+y, uint8(index))
+
+			if kernel == nil {
+				continue
+			}
+			r, g, b, _ := p[index].RGBA()
+			got := [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+			for _, k := range kernel {
+				kx, ky := x+k.dx, y+k.dy
+				if kx < 0 || kx >= w || ky >= h {
+					continue
+				}
+				for i := range v {
+					values[ky*w+kx][i] += (v[i] - got[i]) * k.weight
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+func clampByte(v float64) uint8 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 0xff:
+		return 0xff
+	default:
+		return uint8(v + 0.5)
+	}
+}
@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dialup-inc/ascii/term"
+	"github.com/dialup-inc/ascii/videos"
+	"github.com/dialup-inc/ascii/vpx"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// globeFrame decodes the first frame of the globe video
+func globeFrame(t *testing.T) image.Image {
+	t.Helper()
+
+	reader, err := videos.NewIVFReader(videos.Globe())
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := reader.VPXCodec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := vpx.NewDecoder(codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+
+	data, _, err := reader.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := dec.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img == nil {
+		t.Fatal("first frame didn't decode to a picture")
+	}
+	return img
+}
+
+func TestDitherGolden(t *testing.T) {
+	img := globeFrame(t)
+
+	for mode := RenderMode(0); mode < numRenderModes; mode++ {
+		for dither := Dither(0); dither < numDithers; dither++ {
+			name := fmt.Sprintf("globe-%v-%v", mode, dither)
+			t.Run(name, func(t *testing.T) {
+				opts := RenderOptions{
+					Mode:      mode,
+					ColorMode: term.Color256,
+					Dither:    dither,
+				}
+				got := Image2ANSI(img, 80, 24, 2.0, opts)
+
+				path := filepath.Join("testdata", name+".golden")
+				if *update {
+					if err := ioutil.WriteFile(path, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				want, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatalf("%v (run with -update to create it)", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("output differs from %s (run with -update if the change is intended)", path)
+				}
+			})
+		}
+	}
+}
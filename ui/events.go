@@ -17,15 +17,32 @@ type SentMessageEvent string
 // FrameEvent is sent when the video decoder renders a new frame
 type FrameEvent image.Image
 
+// SelfFrameEvent is sent when the camera captures a new frame
+type SelfFrameEvent image.Image
+
+// ToggleSelfViewEvent shows or hides the camera preview
+type ToggleSelfViewEvent struct{}
+
 // ReceivedChatEvent is fired when the user submits text in the chat input box.
 type ReceivedChatEvent string
 
+// PartnerTypingEvent fires when your partner starts or stops typing a message
+type PartnerTypingEvent bool
+
 // KeypressEvent is fired when the user presses the keyboard.
 type KeypressEvent rune
 
+// KeyEvent is fired when the user presses a key that doesn't type text, like
+// the arrow keys or a ctrl shortcut.
+type KeyEvent term.Key
+
 // BackspaceEvent is fired when the backspace button is pressed.
 type BackspaceEvent struct{}
 
+// ScrollEvent scrolls the chat log by the specified number of lines.
+// Positive values scroll back towards older messages.
+type ScrollEvent int
+
 // ResizeEvent indicates that the terminal window's size has changed to the specified dimensions
 type ResizeEvent term.WinSize
 
@@ -47,6 +64,45 @@ type ConnEndedEvent struct {
 	Reason EndConnReason
 }
 
+// SetColorModeEvent changes the range of colors used to draw video
+type SetColorModeEvent term.ColorMode
+
+// SetRenderModeEvent changes how video is drawn
+type SetRenderModeEvent RenderMode
+
+// CycleRenderModeEvent switches to the next render mode
+type CycleRenderModeEvent struct{}
+
+// SetDitherEvent changes how video is dithered
+type SetDitherEvent Dither
+
+// CycleDitherEvent switches to the next dither
+type CycleDitherEvent struct{}
+
+// SetRampEvent changes the characters used for brightness in ASCII mode
+type SetRampEvent Ramp
+
+// SetShapeMatchEvent turns drawing edges with matching characters on or off
+type SetShapeMatchEvent bool
+
+// SetAdjustmentsEvent changes the corrections applied to video
+type SetAdjustmentsEvent Adjustments
+
+// AdjustBrightnessEvent raises or lowers the brightness by a number of steps
+type AdjustBrightnessEvent int
+
+// AdjustContrastEvent raises or lowers the contrast by a number of steps
+type AdjustContrastEvent int
+
+// AdjustGammaEvent raises or lowers the gamma by a number of steps
+type AdjustGammaEvent int
+
+// ToggleAdjustmentEvent turns one of the on/off adjustments on or off
+type ToggleAdjustmentEvent AdjustToggle
+
+// HideAdjustmentsEvent takes the adjustments back out of the status line
+type HideAdjustmentsEvent struct{}
+
 // SetPageEvent transitions to the specified page
 type SetPageEvent Page
 
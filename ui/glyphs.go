@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"image"
+	"math"
+)
+
+// glyphSize is the width and height of the grid each cell is sampled at
+// when matching glyph shapes
+const glyphSize = 3
+
+// glyphShape is a rough rasterization of a character's strokes
+type glyphShape struct {
+	char rune
+	mask [glyphSize * glyphSize]float64
+}
+
+// edgeGlyphs are the characters that shape matching draws edges with
+var edgeGlyphs = []glyphShape{
+	{'|', [...]float64{
+		0, 1, 0,
+		0, 1, 0,
+		0, 1, 0,
+	}},
+	{'-', [...]float64{
+		0, 0, 0,
+		1, 1, 1,
+		0, 0, 0,
+	}},
+	{'_', [...]float64{
+		0, 0, 0,
+		0, 0, 0,
+		1, 1, 1,
+	}},
+	{'/', [...]float64{
+		0, 0, 1,
+		0, 1, 0,
+		1, 0, 0,
+	}},
+	{'\\', [...]float64{
+		1, 0, 0,
+		0, 1, 0,
+		0, 0, 1,
+	}},
+}
+
+const (
+	// minEdge is the weakest gradient, as a fraction of the brightest
+	// possible edge, that's drawn as an edge instead of a shade
+	minEdge = 0.2
+	// minMatch is the lowest correlation between a cell and a glyph for
+	// the glyph to be used
+	minMatch = 0.6
+)
+
+// matchGlyphs finds the edge glyph that best fits each cell of a cols by
+// rows grid, using a grayscale image sampled at glyphSize pixels per cell.
+// Cells without a clear edge are 0.
+func matchGlyphs(gray *image.Gray, cols, rows int) []rune {
+	edges := sobel(gray)
+	w := gray.Rect.Dx()
+
+	matches := make([]rune, cols*rows)
+	var patch [glyphSize * glyphSize]float64
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			var peak float64
+			for py := 0; py < glyphSize; py++ {
+				for px := 0; px < glyphSize; px++ {
+					e := edges[(y*glyphSize+py)*w+x*glyphSize+px]
+					patch[py*glyphSize+px] = e
+					peak = math.Max(peak, e)
+				}
+			}
+			if peak < minEdge {
+				continue
+			}
+
+			best, bestScore := rune(0), minMatch
+			for _, g := range edgeGlyphs {
+				if score := correlate(patch[:], g.mask[:]); score > bestScore {
+					best, bestScore = g.char, score
+				}
+			}
+			matches[y*cols+x] = best
+		}
+	}
+
+	return matches
+}
+
+// sobel returns the gradient magnitude at each pixel, from 0 to 1
+func sobel(gray *image.Gray) []float64 {
+	rect := gray.Rect
+	w, h := rect.Dx(), rect.Dy()
+
+	at := func(x, y int) float64 {
+		if x < 0 {
+			x = 0
+		}
+		if x >= w {
+			x = w - 1
+		}
+		if y < 0 {
+			y = 0
+		}
+		if y >= h {
+			y = h - 1
+		}
+		return float64(gray.Pix[y*gray.Stride+x]) / 0xff
+	}
+
+	// The largest magnitude is a full black to white step, 4 in each
+	// direction
+	const maxMagnitude = 4 * math.Sqrt2
+
+	edges := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) -
+				at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) -
+				at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			edges[y*w+x] = math.Hypot(gx, gy) / maxMagnitude
+		}
+	}
+
+	return edges
+}
+
+// correlate is the Pearson correlation of a and b, from -1 to 1
+func correlate(a, b []float64) float64 {
+	var meanA, meanB float64
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= float64(len(a))
+	meanB /= float64(len(b))
+
+	var cov, varA, varB float64
+	for i := range a {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+
+	return cov / math.Sqrt(varA*varB)
+}
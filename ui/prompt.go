@@ -0,0 +1,131 @@
+package ui
+
+import "unicode"
+
+// maxHistory is the number of sent messages remembered by the prompt
+const maxHistory = 100
+
+// insert types r at the cursor
+func (p Prompt) insert(r rune) Prompt {
+	if !unicode.IsPrint(r) {
+		return p
+	}
+
+	input := []rune(p.Input)
+	cursor := p.clampedCursor()
+
+	edited := make([]rune, 0, len(input)+1)
+	edited = append(edited, input[:cursor]...)
+	edited = append(edited, r)
+	edited = append(edited, input[cursor:]...)
+
+	p.Input = string(edited)
+	p.Cursor = cursor + 1
+	return p
+}
+
+// deleteRange removes the runes between start and end and moves the cursor
+// to start
+func (p Prompt) deleteRange(start, end int) Prompt {
+	input := []rune(p.Input)
+	if start < 0 {
+		start = 0
+	}
+	if end > len(input) {
+		end = len(input)
+	}
+	if start >= end {
+		return p
+	}
+
+	edited := make([]rune, 0, len(input)-(end-start))
+	edited = append(edited, input[:start]...)
+	edited = append(edited, input[end:]...)
+
+	p.Input = string(edited)
+	p.Cursor = start
+	return p
+}
+
+func (p Prompt) moveTo(cursor int) Prompt {
+	p.Cursor = cursor
+	p.Cursor = p.clampedCursor()
+	return p
+}
+
+func (p Prompt) clampedCursor() int {
+	n := len([]rune(p.Input))
+	switch {
+	case p.Cursor < 0:
+		return 0
+	case p.Cursor > n:
+		return n
+	default:
+		return p.Cursor
+	}
+}
+
+// wordStart finds the beginning of the word before the cursor
+func (p Prompt) wordStart() int {
+	input := []rune(p.Input)
+	i := p.clampedCursor()
+	for i > 0 && unicode.IsSpace(input[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(input[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd finds the end of the word after the cursor
+func (p Prompt) wordEnd() int {
+	input := []rune(p.Input)
+	i := p.clampedCursor()
+	for i < len(input) && unicode.IsSpace(input[i]) {
+		i++
+	}
+	for i < len(input) && !unicode.IsSpace(input[i]) {
+		i++
+	}
+	return i
+}
+
+// recall replaces the input with an entry from the history. pos may be
+// len(p.History), which restores the message being written before browsing.
+func (p Prompt) recall(pos int) Prompt {
+	if pos < 0 || pos > len(p.History) || pos == p.HistoryPos {
+		return p
+	}
+
+	// Save the new message so we can come back to it
+	if p.HistoryPos == len(p.History) {
+		p.Draft = p.Input
+	}
+
+	if pos == len(p.History) {
+		p.Input = p.Draft
+		p.Draft = ""
+	} else {
+		p.Input = p.History[pos]
+	}
+	p.HistoryPos = pos
+	p.Cursor = len([]rune(p.Input))
+	return p
+}
+
+// sent clears the prompt and adds msg to the history
+func (p Prompt) sent(msg string) Prompt {
+	if n := len(p.History); n == 0 || p.History[n-1] != msg {
+		p.History = append(p.History, msg)
+	}
+	if len(p.History) > maxHistory {
+		p.History = p.History[len(p.History)-maxHistory:]
+	}
+
+	p.Input = ""
+	p.Cursor = 0
+	p.Draft = ""
+	p.HistoryPos = len(p.History)
+	return p
+}
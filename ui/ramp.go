@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ramp is a list of characters ordered from darkest to brightest, used to
+// draw brightness in ASCII mode
+type Ramp []rune
+
+var (
+	// RampShort is a small set of characters with distinct weights
+	RampShort = Ramp(" .,:;i1tfLCG08@")
+	// RampLong has 70 levels for finer gradients
+	RampLong = Ramp(" .'`^\",:;Il!i><~+_-?][}{1)(|\\/tfjrxnuvczXYUJCLQ0OZmwqpdbkhao*#MW&8%B@$")
+	// RampBlocks uses the shade block characters
+	RampBlocks = Ramp(" ░▒▓█")
+)
+
+// ParseRamp reads a ramp name, as used in command line flags. Anything
+// that isn't a name is used as the characters of a custom ramp.
+func ParseRamp(s string) (Ramp, error) {
+	switch strings.ToLower(s) {
+	case "short", "":
+		return RampShort, nil
+	case "long":
+		return RampLong, nil
+	case "blocks":
+		return RampBlocks, nil
+	}
+
+	if utf8.RuneCountInString(s) < 2 {
+		return nil, fmt.Errorf("ramp %q needs at least two characters", s)
+	}
+	return Ramp(s), nil
+}
+
+// orDefault returns r, or RampShort if r is too short to use
+func (r Ramp) orDefault() Ramp {
+	if len(r) < 2 {
+		return RampShort
+	}
+	return r
+}
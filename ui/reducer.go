@@ -2,21 +2,25 @@ package ui
 
 import (
 	"image"
-	"regexp"
-	"unicode"
-	"unicode/utf8"
 
 	"github.com/dialup-inc/ascii/term"
 )
 
 func StateReducer(s State, event Event) State {
 	s.Image = imageReducer(s.Image, event)
+	s.SelfImage = selfImageReducer(s.SelfImage, event)
+	s.HideSelfView = hideSelfViewReducer(s.HideSelfView, event)
 	s.ChatActive = chatActiveReducer(s.ChatActive, event)
-	s.Input = inputReducer(s.Input, s.ChatActive, event)
+	s.Prompt = promptReducer(s.Prompt, s.ChatActive, event)
+	prevMessages := s.Messages
 	s.Messages = messagesReducer(s.Messages, event)
+	s.PartnerTyping = partnerTypingReducer(s.PartnerTyping, event)
+	s.ScrollOffset = scrollReducer(s.ScrollOffset, prevMessages, s.Messages, s.PartnerTyping, event)
 	s.Page = pageReducer(s.Page, event)
 	s.WinSize = winSizeReducer(s.WinSize, event)
 	s.HelpOn = helpOnReducer(s.HelpOn, event)
+	s.RenderOptions = renderOptionsReducer(s.RenderOptions, event)
+	s.ShowAdjustments = showAdjustmentsReducer(s.ShowAdjustments, event)
 
 	return s
 }
@@ -32,6 +36,76 @@ func chatActiveReducer(s bool, event Event) bool {
 	}
 }
 
+func partnerTypingReducer(s bool, event Event) bool {
+	switch e := event.(type) {
+	case PartnerTypingEvent:
+		return bool(e)
+	case ReceivedChatEvent:
+		return false
+	case ConnStartedEvent:
+		return false
+	case ConnEndedEvent:
+		return false
+	case SkipEvent:
+		return false
+	default:
+		return s
+	}
+}
+
+// chatLogLines is the number of messages visible in the chat log. The
+// typing indicator takes the last row while it's showing.
+func chatLogLines(partnerTyping bool) int {
+	if partnerTyping {
+		return 2
+	}
+	return 3
+}
+
+func scrollReducer(s int, prevMsgs, msgs []Message, partnerTyping bool, event Event) int {
+	maxOffset := len(msgs) - chatLogLines(partnerTyping)
+	if maxOffset < 0 {
+		maxOffset = 0
+	}
+
+	switch e := event.(type) {
+	case ScrollEvent:
+		s += int(e)
+		if s > maxOffset {
+			s = maxOffset
+		}
+		if s < 0 {
+			s = 0
+		}
+		return s
+
+	case SentMessageEvent:
+		return 0
+
+	default:
+		// Keep the same messages in view when new ones arrive
+		if s > 0 {
+			s += len(msgs) - len(prevMsgs)
+		}
+		// The typing indicator appearing leaves room for fewer messages
+		if s > maxOffset {
+			s = maxOffset
+		}
+		return s
+	}
+}
+
+func showAdjustmentsReducer(s bool, event Event) bool {
+	switch event.(type) {
+	case AdjustBrightnessEvent, AdjustContrastEvent, AdjustGammaEvent, ToggleAdjustmentEvent:
+		return true
+	case HideAdjustmentsEvent:
+		return false
+	default:
+		return s
+	}
+}
+
 func helpOnReducer(s bool, event Event) bool {
 	switch event.(type) {
 	case ToggleHelpEvent:
@@ -63,54 +137,132 @@ func winSizeReducer(s term.WinSize, event Event) term.WinSize {
 	}
 }
 
-var ansiRegex = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
-
-func inputReducer(s string, chatActive bool, event Event) string {
+func promptReducer(s Prompt, chatActive bool, event Event) Prompt {
 	switch e := event.(type) {
 	case ConnStartedEvent:
-		return ""
+		s.Input = ""
+		s.Cursor = 0
+		s.Draft = ""
+		s.HistoryPos = len(s.History)
+		return s
 
 	case KeypressEvent:
 		if !chatActive {
 			return s
 		}
-
-		s += string(e)
-
-		// Strip ANSI escape codes
-		s = ansiRegex.ReplaceAllString(s, "")
-
-		// Strip unprintable characters
-		var printable []rune
-		for _, r := range s {
-			if !unicode.IsPrint(r) {
-				continue
-			}
-			printable = append(printable, r)
-		}
-		s = string(printable)
-
-		return s
+		return s.insert(rune(e))
 
 	case BackspaceEvent:
 		if !chatActive {
 			return s
 		}
+		cursor := s.clampedCursor()
+		return s.deleteRange(cursor-1, cursor)
 
-		if len(s) == 0 {
+	case KeyEvent:
+		if !chatActive {
 			return s
 		}
-		_, sz := utf8.DecodeLastRuneInString(s)
-		return s[:len(s)-sz]
+		return keyReducer(s, term.Key(e))
 
 	case SentMessageEvent:
-		return ""
+		return s.sent(string(e))
+
+	default:
+		return s
+	}
+}
+
+// keyReducer handles line editing keys, which mostly follow readline
+func keyReducer(s Prompt, k term.Key) Prompt {
+	cursor := s.clampedCursor()
+	wordMod := k.Mod&(term.ModCtrl|term.ModAlt) != 0
+
+	switch {
+	case k.Code == term.KeyLeft && wordMod, k.Code == term.KeyRune && k.Mod == term.ModAlt && k.Rune == 'b':
+		return s.moveTo(s.wordStart())
+	case k.Code == term.KeyRight && wordMod, k.Code == term.KeyRune && k.Mod == term.ModAlt && k.Rune == 'f':
+		return s.moveTo(s.wordEnd())
+	case k.Code == term.KeyLeft, k.IsCtrl('b'):
+		return s.moveTo(cursor - 1)
+	case k.Code == term.KeyRight, k.IsCtrl('f'):
+		return s.moveTo(cursor + 1)
+	case k.Code == term.KeyHome, k.IsCtrl('a'):
+		return s.moveTo(0)
+	case k.Code == term.KeyEnd, k.IsCtrl('e'):
+		return s.moveTo(len([]rune(s.Input)))
+
+	case k.Code == term.KeyDelete:
+		return s.deleteRange(cursor, cursor+1)
+	case k.IsCtrl('w'), k.Code == term.KeyBackspace && k.Mod == term.ModAlt:
+		return s.deleteRange(s.wordStart(), cursor)
+	case k.IsCtrl('u'):
+		return s.deleteRange(0, cursor)
+	case k.IsCtrl('k'):
+		return s.deleteRange(cursor, len([]rune(s.Input)))
+
+	case k.Code == term.KeyUp, k.IsCtrl('p'):
+		return s.recall(s.HistoryPos - 1)
+	case k.Code == term.KeyDown, k.IsCtrl('n'):
+		return s.recall(s.HistoryPos + 1)
 
 	default:
 		return s
 	}
 }
 
+func renderOptionsReducer(s RenderOptions, event Event) RenderOptions {
+	switch e := event.(type) {
+	case SetColorModeEvent:
+		s.ColorMode = term.ColorMode(e)
+		return s
+	case SetRenderModeEvent:
+		s.Mode = RenderMode(e)
+		return s
+	case CycleRenderModeEvent:
+		s.Mode = s.Mode.Next()
+		return s
+	case SetDitherEvent:
+		s.Dither = Dither(e)
+		return s
+	case CycleDitherEvent:
+		s.Dither = s.Dither.Next()
+		return s
+	case SetRampEvent:
+		s.Ramp = Ramp(e)
+		return s
+	case SetShapeMatchEvent:
+		s.ShapeMatch = bool(e)
+		return s
+	case SetAdjustmentsEvent:
+		s.Adjust = Adjustments(e)
+		return s
+	case AdjustBrightnessEvent:
+		s.Adjust.Brightness = step(s.Adjust.Brightness, int(e), brightnessStep, -1, 1)
+		return s
+	case AdjustContrastEvent:
+		s.Adjust.Contrast = step(s.Adjust.Contrast, int(e), contrastStep, minScale, maxScale)
+		return s
+	case AdjustGammaEvent:
+		s.Adjust.Gamma = step(s.Adjust.Gamma, int(e), gammaStep, minScale, maxScale)
+		return s
+	case ToggleAdjustmentEvent:
+		switch AdjustToggle(e) {
+		case ToggleEqualize:
+			s.Adjust.Equalize = !s.Adjust.Equalize
+		case ToggleSharpen:
+			s.Adjust.Sharpen = !s.Adjust.Sharpen
+		case ToggleEdgeEnhance:
+			s.Adjust.EdgeEnhance = !s.Adjust.EdgeEnhance
+		case ToggleInvert:
+			s.Adjust.Invert = !s.Adjust.Invert
+		}
+		return s
+	default:
+		return s
+	}
+}
+
 func imageReducer(s image.Image, event Event) image.Image {
 	switch e := event.(type) {
 	case FrameEvent:
@@ -127,6 +279,24 @@ func imageReducer(s image.Image, event Event) image.Image {
 	}
 }
 
+func selfImageReducer(s image.Image, event Event) image.Image {
+	switch e := event.(type) {
+	case SelfFrameEvent:
+		return image.Image(e)
+	default:
+		return s
+	}
+}
+
+func hideSelfViewReducer(s bool, event Event) bool {
+	switch event.(type) {
+	case ToggleSelfViewEvent:
+		return !s
+	default:
+		return s
+	}
+}
+
 func messagesReducer(s []Message, event Event) []Message {
 	switch e := event.(type) {
 	case SentMessageEvent:
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"bytes"
+	"fmt"
 	"image/color"
 	"io"
 	"math"
@@ -22,6 +23,7 @@ const (
 func NewRenderer() *Renderer {
 	return &Renderer{
 		requestFrame: make(chan struct{}),
+		screen:       NewScreen(0, 0),
 	}
 }
 
@@ -31,7 +33,13 @@ type Renderer struct {
 	stateMu sync.Mutex
 	state   State
 
+	// screen tracks what's on the terminal so only changes are sent
+	screen *Screen
+
 	start time.Time
+
+	// mouse is set once the terminal has been asked to report the mouse
+	mouse bool
 }
 
 func (r *Renderer) GetState() State {
@@ -81,8 +89,42 @@ func (r *Renderer) drawVideo(buf *bytes.Buffer, s State, headHeight int) {
 	a.Bold()
 
 	aspect := getAspect(s.WinSize)
-	imgANSI := Image2ANSI(s.Image, vidW, vidH, aspect, false)
+	imgANSI := Image2ANSI(s.Image, vidW, vidH, aspect, s.RenderOptions)
 	buf.Write(imgANSI)
+
+	if s.Page == ChatPage && !s.HideSelfView {
+		r.drawSelfView(buf, s, headHeight, aspect)
+	}
+}
+
+// drawSelfView shows the user's camera in the bottom right corner of the
+// video
+func (r *Renderer) drawSelfView(buf *bytes.Buffer, s State, headHeight int, aspect float64) {
+	if s.SelfImage == nil {
+		return
+	}
+
+	vidW, vidH := s.WinSize.Cols, s.WinSize.Rows-chatHeight-headHeight
+	if vidW < 40 || vidH < 10 {
+		return
+	}
+
+	bounds := s.SelfImage.Bounds()
+	if bounds.Empty() {
+		return
+	}
+
+	w := vidW / 4
+	h := int(float64(w)*float64(bounds.Dy())/float64(bounds.Dx())/aspect + 0.5)
+	if h > vidH/2 {
+		h = vidH / 2
+	}
+
+	// Image2ANSI relies on lines wrapping at the edge of the screen, so
+	// draw onto a screen the size of the preview and copy it over
+	view := NewScreen(h, w)
+	view.Write(Image2ANSI(s.SelfImage, w, h, aspect, s.RenderOptions))
+	view.flushAt(buf, headHeight+vidH-h-1, vidW-w-1)
 }
 
 func (r *Renderer) drawHead(buf *bytes.Buffer, s State) {
@@ -112,7 +154,6 @@ func (r *Renderer) drawPrompt(buf *bytes.Buffer, s State) {
 	a := term.ANSI{buf}
 
 	prompt := " > "
-	input := s.Input
 
 	width := s.WinSize.Cols
 	row := s.WinSize.Rows
@@ -140,25 +181,46 @@ func (r *Renderer) drawPrompt(buf *bytes.Buffer, s State) {
 	buf.WriteString(prompt)
 	lineLen += len(prompt)
 
+	// Leave a column free for the cursor at the end of the line
+	avail := width - lineLen - 1
+	if avail < 1 {
+		return
+	}
+
+	// Scroll the input horizontally so the cursor is always visible
+	input := []rune(s.Prompt.Input)
+	cursor := s.Prompt.clampedCursor()
+
+	var offset int
+	if cursor >= avail {
+		offset = cursor - avail + 1
+	}
+	end := offset + avail
+	if end > len(input) {
+		end = len(input)
+	}
+
 	// Add input
-	input = truncate(input, width-lineLen, "…")
-	buf.WriteString(input)
-	lineLen += len(input)
-
-	// Add blinking cursor where you're supposed to type
-	cursor := "_"
-	if lineLen+len(cursor) < width {
-		a.Foreground(color.White)
+	buf.WriteString(string(input[offset:cursor]))
+	if cursor < len(input) {
+		// Highlight the character under the cursor
+		a.Reverse()
+		buf.WriteRune(input[cursor])
+		a.ReverseOff()
+		buf.WriteString(string(input[cursor+1 : end]))
+		lineLen += end - offset
+	} else {
+		// Add blinking cursor where you're supposed to type
 		a.Blink()
-		buf.WriteString(cursor)
+		buf.WriteString("_")
 		a.BlinkOff()
-		lineLen += len(cursor)
+		lineLen += end - offset + 1
 	}
 
 	// add label
 	label := " Send a message."
 	label = truncate(label, width-lineLen, "")
-	if input == "" {
+	if len(input) == 0 {
 		a.Foreground(color.RGBA{0x33, 0x33, 0x33, 0xFF})
 		buf.WriteString(label)
 		lineLen += len(label)
@@ -192,10 +254,22 @@ func (r *Renderer) drawChat(buf *bytes.Buffer, s State) {
 	a.Background(color.RGBA{0x12, 0x12, 0x12, 0xFF})
 	label := "ASCII Roulette"
 	link := "hit ctrl-t for help"
+	if s.ScrollOffset > 0 {
+		// Let the user know they're not looking at the latest messages
+		link = fmt.Sprintf("↓ %d newer (pgdn)", s.ScrollOffset)
+	}
+	if s.ShowAdjustments {
+		link = s.RenderOptions.Adjust.String()
+		room := width - len(label) - 3
+		if room < 0 {
+			room = 0
+		}
+		link = truncate(link, room, "")
+	}
 	buf.WriteString(" ")
 	a.Foreground(color.RGBA{0x00, 0xff, 0xff, 0xff})
 	buf.WriteString(label)
-	textLen := len(label) + len(link) + 2
+	textLen := len(label) + utf8.RuneCountInString(link) + 2
 	if width > textLen {
 		buf.WriteString(strings.Repeat(" ", width-textLen))
 	}
@@ -256,20 +330,42 @@ func (r *Renderer) drawChat(buf *bytes.Buffer, s State) {
 		}
 	}
 
-	msgs := s.Messages
-	if len(s.Messages) > 3 {
-		msgs = msgs[len(s.Messages)-3:]
+	// Make room for the typing indicator above the prompt
+	logLines := chatLogLines(s.PartnerTyping)
+
+	end := len(s.Messages) - s.ScrollOffset
+	if end < 0 {
+		end = 0
+	}
+	start := end - logLines
+	if start < 0 {
+		start = 0
 	}
+	msgs := s.Messages[start:end]
 	for i, m := range msgs {
 		a.CursorPosition(logTop+i, 0)
 		drawChatLine(m)
 	}
 	// blank if there arent enough messages
-	for i := len(msgs); i < 3; i++ {
+	for i := len(msgs); i < logLines; i++ {
 		a.CursorPosition(logTop+i, 0)
 		buf.WriteString(strings.Repeat(" ", width))
 	}
 
+	if s.PartnerTyping {
+		a.CursorPosition(logTop+logLines, 0)
+		a.Foreground(color.RGBA{0x66, 0x66, 0x66, 0xFF})
+
+		text := " Them is typing…"
+		textLen := utf8.RuneCountInString(text)
+		if width > textLen {
+			buf.WriteString(text)
+			buf.WriteString(strings.Repeat(" ", width-textLen))
+		} else {
+			buf.WriteString(strings.Repeat(" ", width))
+		}
+	}
+
 	r.drawPrompt(buf, s)
 }
 
@@ -399,18 +495,40 @@ func (r *Renderer) drawConfirm(buf *bytes.Buffer, s State) {
 func (r *Renderer) drawHelp(buf *bytes.Buffer, s State) {
 	a := term.ANSI{buf}
 
-	rows := []string{
-		"                 ",
-		"  Skip   ctrl-d  ",
-		"  Help   ctrl-t  ",
-		"  Quit   ctrl-c  ",
-		"                 ",
+	bindings := [][2]string{
+		{"Skip", "ctrl-d"},
+		{"Help", "ctrl-t"},
+		{"Scroll", "pgup/dn"},
+		{"Style", "ctrl-r"},
+		{"Dither", "ctrl-g"},
+		{"Self", "ctrl-v"},
+		{"Camera", "ctrl-o"},
+		{"Bright", "F2/F3"},
+		{"Contr.", "F4/F5"},
+		{"Gamma", "F6/F7"},
+		{"Filter", "F8/F9"},
+		{"Edges", "alt-e"},
+		{"Invert", "alt-i"},
+		{"Quit", "ctrl-c"},
+	}
+
+	// Lay the bindings out in two columns so the box fits in the smallest
+	// window we allow
+	half := (len(bindings) + 1) / 2
+	rows := []string{""}
+	for i := 0; i < half; i++ {
+		line := fmt.Sprintf("  %-6s %-7s", bindings[i][0], bindings[i][1])
+		if j := i + half; j < len(bindings) {
+			line += fmt.Sprintf("  %-6s %-7s", bindings[j][0], bindings[j][1])
+		}
+		rows = append(rows, line)
 	}
+	rows = append(rows, "")
 
 	var boxWidth int
 	for _, r := range rows {
-		if len(r) > boxWidth {
-			boxWidth = len(r)
+		if len(r)+2 > boxWidth {
+			boxWidth = len(r) + 2
 		}
 	}
 
@@ -421,14 +539,14 @@ func (r *Renderer) drawHelp(buf *bytes.Buffer, s State) {
 	a.Bold()
 	a.Background(color.Black)
 	a.Foreground(color.White)
-	buf.WriteString("  Shortcuts      ")
+	fmt.Fprintf(buf, "%-*s", boxWidth, "  Shortcuts")
 
 	a.Normal()
 	a.Foreground(color.Black)
 	a.Background(color.White)
 	for i, line := range rows {
 		a.CursorPosition(boxTop+i+1, boxLeft)
-		buf.WriteString(line)
+		fmt.Fprintf(buf, "%-*s", boxWidth, line)
 	}
 }
 
@@ -490,7 +608,9 @@ func (r *Renderer) draw() {
 		r.drawBlank(buf, s)
 	}
 
-	io.Copy(os.Stdout, buf)
+	r.screen.Resize(s.WinSize.Rows, s.WinSize.Cols)
+	r.screen.Write(buf.Bytes())
+	r.screen.Flush(os.Stdout)
 }
 
 func (r *Renderer) loop() {
@@ -514,15 +634,31 @@ func (r *Renderer) Start() {
 	go r.loop()
 }
 
+// EnableMouse asks the terminal to report the mouse wheel so it can scroll
+// the chat. While it's on, most terminals won't let you select text, so
+// it's turned off again by Stop.
+func (r *Renderer) EnableMouse() {
+	r.stateMu.Lock()
+	r.mouse = true
+	r.stateMu.Unlock()
+
+	a := term.ANSI{os.Stdout}
+	a.EnableMouse()
+}
+
 func (r *Renderer) Stop() {
 	r.stateMu.Lock()
 	s := r.state
+	mouse := r.mouse
 	r.stateMu.Unlock()
 
 	buf := bytes.NewBuffer(nil)
 	a := term.ANSI{buf}
 
 	a.ShowCursor()
+	if mouse {
+		a.DisableMouse()
+	}
 	a.Reset()
 	a.BackgroundReset()
 	a.ForegroundReset()
@@ -0,0 +1,480 @@
+package ui
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dialup-inc/ascii/term"
+)
+
+// Style is the set of graphic attributes a cell is drawn with. Colors hold
+// the SGR parameters that select them, e.g. "38;5;15", or are empty for the
+// terminal's default.
+type Style struct {
+	Fg, Bg  string
+	Bold    bool
+	Blink   bool
+	Reverse bool
+}
+
+// Cell is a single character on the screen
+type Cell struct {
+	Rune  rune
+	Style Style
+}
+
+const (
+	// wideTail fills the cell to the right of a double width character
+	wideTail rune = 0
+	// unknownRune marks cells whose contents on the terminal we don't know
+	unknownRune rune = -1
+)
+
+var blankCell = Cell{Rune: ' '}
+
+// Screen is a model of the terminal's contents. Frames are drawn into it
+// as ANSI escape sequences with Write, then Flush sends only the cells that
+// changed since the last flush.
+type Screen struct {
+	rows, cols int
+
+	// cells is the frame being drawn and shown is what's on the terminal
+	cells []Cell
+	shown []Cell
+
+	// The cursor and pen of the frame being drawn
+	x, y int
+	pen  Style
+
+	// The cursor and pen of the terminal, as left by the last flush
+	termX, termY int
+	termPen      Style
+	termPosKnown bool
+	termPenKnown bool
+
+	// partial holds an incomplete escape sequence or UTF-8 character left
+	// over from the end of the last Write
+	partial []byte
+}
+
+// NewScreen creates a screen with the given size. Nothing is assumed about
+// what the terminal is displaying, so the first flush redraws every cell.
+func NewScreen(rows, cols int) *Screen {
+	s := &Screen{}
+	s.Resize(rows, cols)
+	return s
+}
+
+// Resize changes the size of the screen, forcing a full redraw if it
+// changed
+func (s *Screen) Resize(rows, cols int) {
+	if rows < 0 {
+		rows = 0
+	}
+	if cols < 0 {
+		cols = 0
+	}
+	if rows == s.rows && cols == s.cols && s.cells != nil {
+		return
+	}
+
+	s.rows, s.cols = rows, cols
+	s.cells = make([]Cell, rows*cols)
+	s.shown = make([]Cell, rows*cols)
+	for i := range s.cells {
+		s.cells[i] = blankCell
+	}
+	s.x, s.y = 0, 0
+	s.Invalidate()
+}
+
+// Invalidate forgets what's on the terminal so the next flush redraws
+// everything. Call it after anything else writes to the terminal.
+func (s *Screen) Invalidate() {
+	for i := range s.shown {
+		s.shown[i] = Cell{Rune: unknownRune}
+	}
+	s.termPosKnown = false
+	s.termPenKnown = false
+}
+
+// Write draws text and ANSI escape sequences onto the screen. Like a
+// terminal, the screen keeps its contents between frames.
+func (s *Screen) Write(p []byte) (int, error) {
+	data := p
+	if len(s.partial) > 0 {
+		data = append(s.partial, p...)
+		s.partial = nil
+	}
+
+	for len(data) > 0 {
+		var n int
+		if data[0] == '\033' {
+			n = s.escape(data)
+		} else {
+			n = s.text(data)
+		}
+
+		// Wait for the rest of the sequence
+		if n == 0 {
+			s.partial = append([]byte(nil), data...)
+			break
+		}
+		data = data[n:]
+	}
+
+	return len(p), nil
+}
+
+// text draws the character at the start of data, returning how many bytes
+// it used
+func (s *Screen) text(data []byte) int {
+	if !utf8.FullRune(data) {
+		return 0
+	}
+	r, n := utf8.DecodeRune(data)
+
+	switch r {
+	case '\r':
+		s.x = 0
+	case '\n':
+		s.x = 0
+		s.y++
+	case '\b':
+		if s.x > 0 {
+			s.x--
+		}
+	default:
+		if r >= ' ' {
+			s.put(r)
+		}
+	}
+
+	return n
+}
+
+// put draws r at the cursor, wrapping onto the next line when it reaches
+// the edge of the screen
+func (s *Screen) put(r rune) {
+	width := 1
+	if isWide(r) {
+		width = 2
+	}
+
+	if s.x+width > s.cols {
+		s.x = 0
+		s.y++
+	}
+	if s.y >= s.rows || s.x+width > s.cols {
+		// Off the bottom of the screen
+		return
+	}
+
+	i := s.y*s.cols + s.x
+	s.cells[i] = Cell{Rune: r, Style: s.pen}
+	if width == 2 {
+		s.cells[i+1] = Cell{Rune: wideTail, Style: s.pen}
+	}
+	s.x += width
+}
+
+// escape interprets the escape sequence at the start of data, returning how
+// many bytes it used
+func (s *Screen) escape(data []byte) int {
+	if len(data) < 2 {
+		return 0
+	}
+	if data[1] != '[' {
+		if data[1] == 'c' {
+			s.reset()
+		}
+		return 2
+	}
+
+	// Find the final byte of the Control Sequence
+	end := -1
+	for i := 2; i < len(data); i++ {
+		if data[i] >= 0x40 && data[i] <= 0x7E {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return 0
+	}
+
+	params := string(data[2:end])
+	switch data[end] {
+	case 'H', 'f':
+		s.moveCursor(params)
+	case 'm':
+		s.setPen(params)
+	case 'J':
+		if params == "2" {
+			s.fill(Cell{Rune: ' ', Style: Style{Bg: s.pen.Bg}})
+		}
+	}
+
+	return end + 1
+}
+
+func (s *Screen) reset() {
+	s.pen = Style{}
+	s.x, s.y = 0, 0
+	s.fill(blankCell)
+}
+
+func (s *Screen) fill(c Cell) {
+	for i := range s.cells {
+		s.cells[i] = c
+	}
+}
+
+func (s *Screen) moveCursor(params string) {
+	row, col := 1, 1
+	parts := strings.Split(params, ";")
+	if n, err := strconv.Atoi(parts[0]); err == nil && n > 0 {
+		row = n
+	}
+	if len(parts) > 1 {
+		if n, err := strconv.Atoi(parts[1]); err == nil && n > 0 {
+			col = n
+		}
+	}
+
+	s.y = clamp(row-1, 0, s.rows)
+	s.x = clamp(col-1, 0, s.cols)
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// setPen applies Select Graphic Rendition parameters
+func (s *Screen) setPen(params string) {
+	parts := strings.Split(params, ";")
+	for i := 0; i < len(parts); i++ {
+		p := parts[i]
+
+		switch p {
+		case "", "0":
+			s.pen = Style{}
+		case "1":
+			s.pen.Bold = true
+		case "22":
+			s.pen.Bold = false
+		case "5":
+			s.pen.Blink = true
+		case "25":
+			s.pen.Blink = false
+		case "7":
+			s.pen.Reverse = true
+		case "27":
+			s.pen.Reverse = false
+		case "39":
+			s.pen.Fg = ""
+		case "49":
+			s.pen.Bg = ""
+		case "38", "48":
+			// Extended colors, either "5;index" or "2;r;g;b"
+			n := 0
+			if i+1 < len(parts) {
+				switch parts[i+1] {
+				case "5":
+					n = 2
+				case "2":
+					n = 4
+				}
+			}
+			if n == 0 || i+n >= len(parts) {
+				return
+			}
+
+			color := strings.Join(parts[i:i+n+1], ";")
+			if p == "38" {
+				s.pen.Fg = color
+			} else {
+				s.pen.Bg = color
+			}
+			i += n
+		default:
+			code, err := strconv.Atoi(p)
+			if err != nil {
+				continue
+			}
+			switch {
+			case code >= 30 && code <= 37, code >= 90 && code <= 97:
+				s.pen.Fg = p
+			case code >= 40 && code <= 47, code >= 100 && code <= 107:
+				s.pen.Bg = p
+			}
+		}
+	}
+}
+
+// maxSkip is the furthest we'll move the cursor right by reprinting
+// unchanged cells, which is shorter than an escape sequence
+const maxSkip = 3
+
+// Flush writes the cells that changed since the last flush to w
+func (s *Screen) Flush(w io.Writer) error {
+	return s.flushAt(w, 0, 0)
+}
+
+// flushAt is like Flush, but draws the screen with its top left corner at
+// the given row and column of the terminal, counting from 0
+func (s *Screen) flushAt(w io.Writer, top, left int) error {
+	buf := bytes.NewBuffer(nil)
+	a := term.ANSI{buf}
+
+	for y := 0; y < s.rows; y++ {
+		for x := 0; x < s.cols; x++ {
+			i := y*s.cols + x
+			c := s.cells[i]
+			if c == s.shown[i] || c.Rune == wideTail {
+				continue
+			}
+
+			if !s.termPosKnown || s.termY != y || s.termX != x {
+				if !s.skipTo(buf, x, y) {
+					a.CursorPosition(top+y+1, left+x+1)
+					s.termX, s.termY = x, y
+					s.termPosKnown = true
+				}
+			}
+			s.draw(buf, c)
+			s.shown[i] = c
+			if isWide(c.Rune) && x+1 < s.cols {
+				s.shown[i+1] = s.cells[i+1]
+			}
+		}
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := io.Copy(w, buf)
+	return err
+}
+
+// skipTo moves the terminal's cursor right to x by reprinting the cells in
+// between, if that's possible and cheap
+func (s *Screen) skipTo(buf *bytes.Buffer, x, y int) bool {
+	if !s.termPosKnown || !s.termPenKnown || s.termY != y {
+		return false
+	}
+	if x < s.termX || x-s.termX > maxSkip {
+		return false
+	}
+
+	row := s.cells[y*s.cols : (y+1)*s.cols]
+	for _, c := range row[s.termX:x] {
+		if c.Rune >= utf8.RuneSelf || c.Rune < ' ' || c.Style != s.termPen {
+			return false
+		}
+	}
+	for _, c := range row[s.termX:x] {
+		buf.WriteRune(c.Rune)
+	}
+	s.termX = x
+	return true
+}
+
+// draw writes c at the terminal's cursor
+func (s *Screen) draw(buf *bytes.Buffer, c Cell) {
+	s.writePen(buf, c.Style)
+	buf.WriteRune(c.Rune)
+
+	if isWide(c.Rune) {
+		s.termX += 2
+	} else {
+		s.termX++
+	}
+
+	// The terminal's cursor hangs off the edge until the next character,
+	// which terminals disagree about, so move explicitly next time
+	if s.termX >= s.cols {
+		s.termPosKnown = false
+	}
+}
+
+// writePen changes the terminal's graphic attributes to style using as few
+// parameters as possible
+func (s *Screen) writePen(buf *bytes.Buffer, style Style) {
+	if s.termPenKnown && style == s.termPen {
+		return
+	}
+
+	var params []string
+	from := s.termPen
+	if !s.termPenKnown {
+		params = append(params, "0")
+		from = Style{}
+	}
+
+	if style.Bold != from.Bold {
+		params = append(params, sgrFlag(style.Bold, "1", "22"))
+	}
+	if style.Blink != from.Blink {
+		params = append(params, sgrFlag(style.Blink, "5", "25"))
+	}
+	if style.Reverse != from.Reverse {
+		params = append(params, sgrFlag(style.Reverse, "7", "27"))
+	}
+	if style.Fg != from.Fg {
+		params = append(params, orDefault(style.Fg, "39"))
+	}
+	if style.Bg != from.Bg {
+		params = append(params, orDefault(style.Bg, "49"))
+	}
+
+	buf.WriteString("\033[")
+	buf.WriteString(strings.Join(params, ";"))
+	buf.WriteByte('m')
+
+	s.termPen = style
+	s.termPenKnown = true
+}
+
+func sgrFlag(on bool, set, unset string) string {
+	if on {
+		return set
+	}
+	return unset
+}
+
+func orDefault(color, def string) string {
+	if color == "" {
+		return def
+	}
+	return color
+}
+
+// isWide reports whether r takes up two columns, as emoji and East Asian
+// characters do in most terminals
+func isWide(r rune) bool {
+	switch {
+	case r >= 0x1100 && r <= 0x115F,
+		r >= 0x2E80 && r <= 0xA4CF && r != 0x303F,
+		r >= 0xAC00 && r <= 0xD7A3,
+		r >= 0xF900 && r <= 0xFAFF,
+		r >= 0xFE30 && r <= 0xFE4F,
+		r >= 0xFF00 && r <= 0xFF60,
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F300 && r <= 0x1F64F,
+		r >= 0x1F900 && r <= 0x1F9FF,
+		r >= 0x20000 && r <= 0x3FFFD:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,254 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"testing"
+
+	"github.com/dialup-inc/ascii/term"
+)
+
+func cellAt(s *Screen, x, y int) Cell {
+	return s.cells[y*s.cols+x]
+}
+
+func flushString(t *testing.T, s *Screen) string {
+	t.Helper()
+
+	buf := bytes.NewBuffer(nil)
+	if err := s.Flush(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestScreenWriteSplitSequences(t *testing.T) {
+	s := NewScreen(1, 10)
+
+	// An escape sequence and a UTF-8 character, each split across writes
+	chunks := []string{"\033", "[3", "1mA", "\xc3", "\xa9B"}
+	for _, c := range chunks {
+		if n, err := s.Write([]byte(c)); n != len(c) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", c, n, err)
+		}
+	}
+
+	want := []Cell{
+		{Rune: 'A', Style: Style{Fg: "31"}},
+		{Rune: 'é', Style: Style{Fg: "31"}},
+		{Rune: 'B', Style: Style{Fg: "31"}},
+		blankCell,
+	}
+	for x, c := range want {
+		if got := cellAt(s, x, 0); got != c {
+			t.Errorf("cell %d = %+v, want %+v", x, got, c)
+		}
+	}
+}
+
+func TestScreenWideRunes(t *testing.T) {
+	s := NewScreen(2, 3)
+	s.Write([]byte("a世b"))
+
+	want := []Cell{
+		{Rune: 'a'}, {Rune: '世'}, {Rune: wideTail},
+		{Rune: 'b'}, blankCell, blankCell,
+	}
+	for i, c := range want {
+		if got := s.cells[i]; got != c {
+			t.Errorf("cell %d = %+v, want %+v", i, got, c)
+		}
+	}
+
+	// A wide character that doesn't fit wraps to the next line whole
+	s = NewScreen(2, 3)
+	s.Write([]byte("ab世"))
+	if got := cellAt(s, 2, 0); got != blankCell {
+		t.Errorf("end of first line = %+v, want blank", got)
+	}
+	if got := cellAt(s, 0, 1); got.Rune != '世' {
+		t.Errorf("start of second line = %+v, want 世", got)
+	}
+}
+
+func TestScreenSGR(t *testing.T) {
+	tests := []struct {
+		seq  string
+		want Style
+	}{
+		{"\033[38;5;196m", Style{Fg: "38;5;196"}},
+		{"\033[48;5;21m", Style{Bg: "48;5;21"}},
+		{"\033[38;2;1;2;3m", Style{Fg: "38;2;1;2;3"}},
+		{"\033[1;38;2;10;20;30;48;5;7;7m", Style{Fg: "38;2;10;20;30", Bg: "48;5;7", Bold: true, Reverse: true}},
+		{"\033[31;44m", Style{Fg: "31", Bg: "44"}},
+		{"\033[38;5;196;39m", Style{}},
+		{"\033[1;5;0m", Style{}},
+		// A truncated extended color is ignored
+		{"\033[38;5m", Style{}},
+	}
+
+	for _, tt := range tests {
+		s := NewScreen(1, 1)
+		s.Write([]byte(tt.seq + "x"))
+		if got := cellAt(s, 0, 0).Style; got != tt.want {
+			t.Errorf("%q: style = %+v, want %+v", tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestScreenFlush(t *testing.T) {
+	s := NewScreen(2, 4)
+	s.Write([]byte("\033[31mab"))
+
+	// Nothing is known about the terminal, so everything is drawn
+	got := flushString(t, s)
+	want := "\033[H\033[0;31mab\033[39m  \033[2H    "
+	if got != want {
+		t.Errorf("first flush = %q, want %q", got, want)
+	}
+
+	if got := flushString(t, s); got != "" {
+		t.Errorf("flush without changes = %q, want nothing", got)
+	}
+
+	s.Write([]byte("\033[2;2H\033[31mc"))
+	got = flushString(t, s)
+	want = "\033[2;2H\033[31mc"
+	if got != want {
+		t.Errorf("flush after change = %q, want %q", got, want)
+	}
+
+	// Invalidate redraws everything again
+	s.Invalidate()
+	got = flushString(t, s)
+	want = "\033[H\033[0;31mab\033[39m  \033[2H \033[31mc\033[39m  "
+	if got != want {
+		t.Errorf("flush after Invalidate = %q, want %q", got, want)
+	}
+}
+
+func TestScreenFlushSkip(t *testing.T) {
+	tests := []struct {
+		name   string
+		change string
+		want   string
+	}{
+		// Reprinting one cell is shorter than moving the cursor
+		{"close", "\033[HX\033[1;3HY", "\033[HXbY"},
+		{"far", "\033[HX\033[1;7HY", "\033[HX\033[1;7HY"},
+		// Cells in another style can't be reprinted without changing pen
+		{"styled", "\033[HX\033[1;3HY", "\033[HX\033[1;3HY"},
+	}
+
+	for _, tt := range tests {
+		s := NewScreen(1, 10)
+		if tt.name == "styled" {
+			s.Write([]byte("a\033[7mb\033[0mcdefghij"))
+		} else {
+			s.Write([]byte("abcdefghij"))
+		}
+		flushString(t, s)
+
+		s.Write([]byte(tt.change))
+		if got := flushString(t, s); got != tt.want {
+			t.Errorf("%s: flush = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScreenSkipTo(t *testing.T) {
+	s := NewScreen(1, 10)
+	s.Write([]byte("abcdefghij"))
+	flushString(t, s)
+
+	s.termX, s.termY, s.termPosKnown = 1, 0, true
+
+	buf := bytes.NewBuffer(nil)
+	if !s.skipTo(buf, 3, 0) || buf.String() != "bc" || s.termX != 3 {
+		t.Errorf("skipTo(3) wrote %q, cursor at %d; want \"bc\" and 3", buf.String(), s.termX)
+	}
+
+	buf.Reset()
+	if s.skipTo(buf, 1, 0) || buf.Len() != 0 {
+		t.Errorf("skipTo moved the cursor backwards")
+	}
+	if s.skipTo(buf, 3+maxSkip+1, 0) || buf.Len() != 0 {
+		t.Errorf("skipTo went further than maxSkip")
+	}
+
+	s.termPenKnown = false
+	if s.skipTo(buf, 4, 0) || buf.Len() != 0 {
+		t.Errorf("skipTo reprinted cells with an unknown pen")
+	}
+}
+
+// benchFrames draws a sequence of video frames of a box drifting across a
+// gradient, as the renderer would write them
+func benchFrames(mode RenderMode, rows, cols, n int) [][]byte {
+	const size = 240
+	frames := make([][]byte, n)
+	for i := range frames {
+		img := image.NewRGBA(image.Rect(0, 0, size*4/3, size))
+		for x := 0; x < img.Rect.Dx(); x++ {
+			c := color.RGBA{uint8(x * 0xff / img.Rect.Dx()), 0x40, 0x80, 0xff}
+			draw.Draw(img, image.Rect(x, 0, x+1, size), image.NewUniform(c), image.ZP, draw.Src)
+		}
+		box := image.Rect(0, 0, size/4, size/4).Add(image.Pt(20+i*2, 60+i))
+		draw.Draw(img, box, image.White, image.ZP, draw.Src)
+
+		buf := bytes.NewBuffer(nil)
+		a := term.ANSI{buf}
+		a.CursorPosition(1, 1)
+		buf.Write(Image2ANSI(img, cols, rows, 2.0, RenderOptions{Mode: mode}))
+		frames[i] = buf.Bytes()
+	}
+	return frames
+}
+
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// BenchmarkScreen compares the bytes sent per frame when whole frames are
+// written with when only the changes are flushed from a Screen, logging the
+// bytes per frame with each result
+func BenchmarkScreen(b *testing.B) {
+	const rows, cols = 40, 120
+
+	for mode := RenderMode(0); mode < numRenderModes; mode++ {
+		frames := benchFrames(mode, rows, cols, 30)
+
+		b.Run(fmt.Sprintf("%v/full", mode), func(b *testing.B) {
+			w := &countingWriter{}
+			for i := 0; i < b.N; i++ {
+				w.Write(frames[i%len(frames)])
+			}
+			b.Logf("%.0f B/frame", float64(w.n)/float64(b.N))
+		})
+
+		b.Run(fmt.Sprintf("%v/screen", mode), func(b *testing.B) {
+			s := NewScreen(rows, cols)
+			// Start from a terminal that already shows the video, so the
+			// first full redraw isn't counted
+			s.Write(frames[len(frames)-1])
+			s.Flush(ioutil.Discard)
+
+			w := &countingWriter{}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Write(frames[i%len(frames)])
+				s.Flush(w)
+			}
+			b.Logf("%.0f B/frame", float64(w.n)/float64(b.N))
+		})
+	}
+}
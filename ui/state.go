@@ -20,12 +20,43 @@ type State struct {
 
 	HelpOn bool
 
-	Input      string
+	Prompt     Prompt
 	ChatActive bool
 
+	PartnerTyping bool
+
 	Messages []Message
-	Image    image.Image
-	WinSize  term.WinSize
+	// ScrollOffset is how many messages the chat log is scrolled back from
+	// the most recent one
+	ScrollOffset int
+
+	Image   image.Image
+	WinSize term.WinSize
+
+	// SelfImage is the latest frame from the user's camera
+	SelfImage image.Image
+	// HideSelfView turns off the camera preview in the corner of the video
+	HideSelfView bool
+
+	RenderOptions RenderOptions
+	// ShowAdjustments puts the current image adjustments in the status
+	// line while they're being changed
+	ShowAdjustments bool
+}
+
+// Prompt is the text box where the user types chat messages
+type Prompt struct {
+	Input string
+	// Cursor is the position of the cursor in Input, counted in runes
+	Cursor int
+
+	// History holds the messages the user has sent, oldest first
+	History []string
+	// HistoryPos is the index of the History entry being shown. It's equal
+	// to len(History) when the user is writing a new message.
+	HistoryPos int
+	// Draft holds the new message while the user browses History
+	Draft string
 }
 
 type MessageType int
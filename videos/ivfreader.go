@@ -3,7 +3,10 @@ package videos
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+
+	"github.com/dialup-inc/ascii/vpx"
 )
 
 type IVFReader struct {
@@ -52,6 +55,18 @@ func (i *IVFReader) Codec() string {
 	return string(i.Header.Codec[:])
 }
 
+// VPXCodec returns the codec to decode the file with
+func (i *IVFReader) VPXCodec() (vpx.Codec, error) {
+	switch c := i.Codec(); c {
+	case "VP80":
+		return vpx.VP8, nil
+	case "VP90":
+		return vpx.VP9, nil
+	default:
+		return 0, fmt.Errorf("unknown codec %q", c)
+	}
+}
+
 func (i *IVFReader) ReadFrame() (data []byte, pts uint64, err error) {
 	var hdr IVFFrameHeader
 	if err := binary.Read(i.reader, binary.LittleEndian, &hdr); err != nil {
@@ -2,7 +2,6 @@ package videos
 
 import (
 	"context"
-	"fmt"
 	"image"
 	"io"
 	"sync"
@@ -59,6 +58,9 @@ func (p *Player) Play(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		if img == nil {
+			continue
+		}
 
 		waitTime := period - time.Since(lastFrame)
 		select {
@@ -78,11 +80,12 @@ func NewPlayer(r io.ReadSeeker) (*Player, error) {
 	if err != nil {
 		return nil, err
 	}
-	if c := ivf.Codec(); c != "VP80" {
-		return nil, fmt.Errorf("unknown codec %q", c)
+	codec, err := ivf.VPXCodec()
+	if err != nil {
+		return nil, err
 	}
 
-	decoder, err := vpx.NewDecoder(int(ivf.Header.Width), int(ivf.Header.Height))
+	decoder, err := vpx.NewDecoder(codec)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,190 @@
+package ascii
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// VP9 RTP packets start with a payload descriptor, described in
+// https://tools.ietf.org/html/draft-ietf-payload-vp9
+const (
+	vp9PictureID       = 0x80 // I
+	vp9InterPicture    = 0x40 // P
+	vp9LayerIndices    = 0x20 // L
+	vp9FlexibleMode    = 0x10 // F
+	vp9StartOfFrame    = 0x08 // B
+	vp9EndOfFrame      = 0x04 // E
+	vp9ScalabilityInfo = 0x02 // V
+
+	// vp9ExtendedPictureID marks a 15 bit picture ID
+	vp9ExtendedPictureID = 0x80
+
+	// vp9HeaderSize is the size of the descriptors we send: the flags and
+	// a 15 bit picture ID
+	vp9HeaderSize = 3
+)
+
+// vp9Payloader splits VP9 frames into RTP payloads. We send one spatial
+// layer with no scalability structure, so the descriptor is just the
+// frame boundaries, whether the frame depends on others and a picture ID.
+type vp9Payloader struct {
+	pictureID uint16
+	started   bool
+}
+
+func (p *vp9Payloader) Payload(mtu int, payload []byte) [][]byte {
+	if len(payload) == 0 || mtu <= vp9HeaderSize {
+		return nil
+	}
+
+	if !p.started {
+		p.pictureID = uint16(rand.Intn(1 << 15))
+		p.started = true
+	}
+
+	key := vp9Keyframe(payload)
+
+	maxSize := mtu - vp9HeaderSize
+	var out [][]byte
+	for i := 0; i < len(payload); i += maxSize {
+		end := i + maxSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		flags := byte(vp9PictureID)
+		if !key {
+			flags |= vp9InterPicture
+		}
+		if i == 0 {
+			flags |= vp9StartOfFrame
+		}
+		if end == len(payload) {
+			flags |= vp9EndOfFrame
+		}
+
+		packet := make([]byte, vp9HeaderSize+end-i)
+		packet[0] = flags
+		packet[1] = vp9ExtendedPictureID | byte(p.pictureID>>8)
+		packet[2] = byte(p.pictureID)
+		copy(packet[vp9HeaderSize:], payload[i:end])
+		out = append(out, packet)
+	}
+
+	p.pictureID = (p.pictureID + 1) & 0x7fff
+	return out
+}
+
+// vp9Keyframe reads the frame type from the start of a VP9 frame's
+// uncompressed header
+func vp9Keyframe(frame []byte) bool {
+	b := frame[0]
+	if b>>6 != 2 {
+		// Not a frame marker
+		return false
+	}
+
+	// Profile 3 has an extra reserved bit after the profile
+	profile := (b>>5)&1 | (b>>4)&1<<1
+	shift := uint(3)
+	if profile == 3 {
+		shift--
+	}
+
+	// Frames that show an earlier one again have no frame type
+	if b>>shift&1 != 0 {
+		return false
+	}
+	return b>>(shift-1)&1 == 0
+}
+
+var errShortVP9Packet = errors.New("VP9 packet is too short")
+
+// vp9Packet strips the payload descriptor from VP9 RTP payloads. It skips
+// every field the draft defines, not just the ones we send.
+type vp9Packet struct{}
+
+func (vp9Packet) Unmarshal(packet []byte) ([]byte, error) {
+	if len(packet) < 1 {
+		return nil, errShortVP9Packet
+	}
+	flags := packet[0]
+	pos := 1
+
+	// skip moves past n bytes of the descriptor
+	skip := func(n int) error {
+		pos += n
+		if pos > len(packet) {
+			return errShortVP9Packet
+		}
+		return nil
+	}
+
+	if flags&vp9PictureID != 0 {
+		if err := skip(1); err != nil {
+			return nil, err
+		}
+		if packet[pos-1]&vp9ExtendedPictureID != 0 {
+			if err := skip(1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if flags&vp9LayerIndices != 0 {
+		if err := skip(1); err != nil {
+			return nil, err
+		}
+		// Non-flexible mode adds TL0PICIDX
+		if flags&vp9FlexibleMode == 0 {
+			if err := skip(1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Reference indices, each with a bit saying if there's another
+	if flags&vp9FlexibleMode != 0 && flags&vp9InterPicture != 0 {
+		for {
+			if err := skip(1); err != nil {
+				return nil, err
+			}
+			if packet[pos-1]&0x01 == 0 {
+				break
+			}
+		}
+	}
+
+	if flags&vp9ScalabilityInfo != 0 {
+		if err := skip(1); err != nil {
+			return nil, err
+		}
+		ss := packet[pos-1]
+		layers := int(ss>>5) + 1
+
+		// Y: each layer's resolution
+		if ss&0x10 != 0 {
+			if err := skip(4 * layers); err != nil {
+				return nil, err
+			}
+		}
+		// G: the picture group description
+		if ss&0x08 != 0 {
+			if err := skip(1); err != nil {
+				return nil, err
+			}
+			pictures := int(packet[pos-1])
+			for i := 0; i < pictures; i++ {
+				if err := skip(1); err != nil {
+					return nil, err
+				}
+				refs := int(packet[pos-1]>>2) & 0x03
+				if err := skip(refs); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return packet[pos:], nil
+}
@@ -0,0 +1,70 @@
+package ascii
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVP9Keyframe(t *testing.T) {
+	tests := []struct {
+		name  string
+		first byte
+		want  bool
+	}{
+		{"profile 0 keyframe", 0x80, true},
+		{"profile 0 inter frame", 0x84, false},
+		{"profile 1 keyframe", 0xa0, true},
+		{"profile 3 keyframe", 0xb0, true},
+		{"profile 3 inter frame", 0xb2, false},
+		{"shown again", 0x88, false},
+		{"no frame marker", 0x00, false},
+	}
+
+	for _, tt := range tests {
+		if got := vp9Keyframe([]byte{tt.first, 0x49, 0x83}); got != tt.want {
+			t.Errorf("%s: keyframe = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVP9PayloadRoundTrip(t *testing.T) {
+	const mtu = 10 + vp9HeaderSize
+
+	for _, tt := range []struct {
+		name  string
+		frame []byte
+		inter bool
+	}{
+		{"keyframe", append([]byte{0x80}, bytes.Repeat([]byte{1}, 24)...), false},
+		{"inter frame", append([]byte{0x84}, bytes.Repeat([]byte{2}, 24)...), true},
+	} {
+		p := &vp9Payloader{}
+		payloads := p.Payload(mtu, tt.frame)
+		if len(payloads) != 3 {
+			t.Fatalf("%s: split into %d packets, want 3", tt.name, len(payloads))
+		}
+
+		var joined []byte
+		for i, pl := range payloads {
+			flags := pl[0]
+			if got := flags&vp9InterPicture != 0; got != tt.inter {
+				t.Errorf("%s: packet %d inter picture = %v, want %v", tt.name, i, got, tt.inter)
+			}
+			if got := flags&vp9StartOfFrame != 0; got != (i == 0) {
+				t.Errorf("%s: packet %d start of frame = %v", tt.name, i, got)
+			}
+			if got := flags&vp9EndOfFrame != 0; got != (i == len(payloads)-1) {
+				t.Errorf("%s: packet %d end of frame = %v", tt.name, i, got)
+			}
+
+			data, err := vp9Packet{}.Unmarshal(pl)
+			if err != nil {
+				t.Fatalf("%s: packet %d: %v", tt.name, i, err)
+			}
+			joined = append(joined, data...)
+		}
+		if !bytes.Equal(joined, tt.frame) {
+			t.Errorf("%s: reassembled %v, want %v", tt.name, joined, tt.frame)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package vpx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Codec is a video format libvpx can encode and decode
+type Codec int
+
+const (
+	VP8 Codec = iota
+	// VP9 looks much better than VP8 at low bitrates, but takes more CPU
+	VP9
+)
+
+func (c Codec) String() string {
+	switch c {
+	case VP8:
+		return "VP8"
+	case VP9:
+		return "VP9"
+	default:
+		return fmt.Sprintf("Codec(%d)", int(c))
+	}
+}
+
+// ParseCodec reads a codec name like "vp9", as used in command line flags
+// and SDP
+func ParseCodec(s string) (Codec, error) {
+	switch strings.ToUpper(s) {
+	case "VP8":
+		return VP8, nil
+	case "VP9":
+		return VP9, nil
+	default:
+		return 0, fmt.Errorf("unknown codec %q", s)
+	}
+}
+
+// EndUsage is the encoder's rate control mode
+type EndUsage int
+
+// These match vpx_rc_mode in vpx_encoder.h
+const (
+	// VBR lets the bitrate vary with how hard the video is to encode
+	VBR EndUsage = iota
+	// CBR holds the bitrate steady, which suits live calls
+	CBR
+	// CQ is VBR with a cap on quality, to save bits on easy scenes
+	CQ
+	// Q keeps the quality constant, whatever the bitrate
+	Q
+)
+
+func (u EndUsage) String() string {
+	switch u {
+	case VBR:
+		return "vbr"
+	case CBR:
+		return "cbr"
+	case CQ:
+		return "cq"
+	case Q:
+		return "q"
+	default:
+		return fmt.Sprintf("EndUsage(%d)", int(u))
+	}
+}
+
+// Deadline is how long the encoder may spend on each frame, in
+// microseconds
+type Deadline uint
+
+// These match the VPX_DL_ constants in vpx_encoder.h
+const (
+	// DeadlineBest spends as long as it takes for the best quality
+	DeadlineBest Deadline = 0
+	// DeadlineRealtime encodes as fast as possible
+	DeadlineRealtime Deadline = 1
+	// DeadlineGood balances speed and quality
+	DeadlineGood Deadline = 1000000
+)
+
+func (d Deadline) String() string {
+	switch d {
+	case DeadlineBest:
+		return "best"
+	case DeadlineRealtime:
+		return "realtime"
+	case DeadlineGood:
+		return "good"
+	default:
+		return fmt.Sprintf("%dus", uint(d))
+	}
+}
+
+// EncoderConfig holds the settings for an Encoder
+type EncoderConfig struct {
+	// Codec is the format to encode. In calls it's the one we'd rather
+	// use, if our partner supports it.
+	Codec Codec
+	// TargetBitrate is in kilobits per second
+	TargetBitrate int
+	// MinQuantizer and MaxQuantizer bound the quality, from 0 (best) to 63
+	MinQuantizer int
+	MaxQuantizer int
+	// KeyframeInterval is the most frames allowed between keyframes
+	KeyframeInterval int
+	// CPUUsed trades quality for speed, from -16 to 16 for VP8 and -9 to 9
+	// for VP9. Further from zero is faster. VP9 is far too slow for calls
+	// at zero, so zero means vp9DefaultCPUUsed there.
+	CPUUsed int
+	// Threads is the number of threads to encode with. Zero picks one.
+	Threads  int
+	Deadline Deadline
+	// ErrorResilient makes the stream easier to recover from packet loss
+	ErrorResilient bool
+	EndUsage       EndUsage
+}
+
+// vp9DefaultCPUUsed is the VP9 speed used when CPUUsed isn't set, which is
+// fast enough to encode calls in realtime
+const vp9DefaultCPUUsed = 7
+
+// DefaultEncoderConfig returns settings for video calls at the given size
+func DefaultEncoderConfig(width, height int) EncoderConfig {
+	return EncoderConfig{
+		Codec: VP8,
+		// libvpx defaults to 256 kbps at 320x240
+		TargetBitrate:    width * height * 256 / (320 * 240),
+		MinQuantizer:     4,
+		MaxQuantizer:     63,
+		KeyframeInterval: 1000,
+		Deadline:         DeadlineRealtime,
+		ErrorResilient:   true,
+		EndUsage:         CBR,
+	}
+}
+
+// validate checks the settings libvpx doesn't check itself
+func (c EncoderConfig) validate() error {
+	if c.Codec != VP8 && c.Codec != VP9 {
+		return VPX_CODEC_INVALID_PARAM
+	}
+	if c.TargetBitrate <= 0 {
+		return VPX_CODEC_INVALID_PARAM
+	}
+	if c.Threads < 0 {
+		return VPX_CODEC_INVALID_PARAM
+	}
+	if c.EndUsage < VBR || c.EndUsage > Q {
+		return VPX_CODEC_INVALID_PARAM
+	}
+	return nil
+}
+
+// ParseEncoderConfig changes base with a comma-separated list of settings
+// like "bitrate=400,cpu-used=8,deadline=good", as used in command line
+// flags
+func ParseEncoderConfig(s string, base EncoderConfig) (EncoderConfig, error) {
+	cfg := base
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return EncoderConfig{}, fmt.Errorf("encoder setting %q needs a value", field)
+		}
+		name, value := strings.ToLower(parts[0]), strings.ToLower(parts[1])
+
+		switch name {
+		case "codec":
+			codec, err := ParseCodec(value)
+			if err != nil {
+				return EncoderConfig{}, err
+			}
+			cfg.Codec = codec
+			continue
+		case "deadline":
+			switch value {
+			case "best":
+				cfg.Deadline = DeadlineBest
+			case "realtime":
+				cfg.Deadline = DeadlineRealtime
+			case "good":
+				cfg.Deadline = DeadlineGood
+			default:
+				return EncoderConfig{}, fmt.Errorf("unknown deadline %q", value)
+			}
+			continue
+		case "end-usage":
+			switch value {
+			case "vbr":
+				cfg.EndUsage = VBR
+			case "cbr":
+				cfg.EndUsage = CBR
+			case "cq":
+				cfg.EndUsage = CQ
+			case "q":
+				cfg.EndUsage = Q
+			default:
+				return EncoderConfig{}, fmt.Errorf("unknown end usage %q", value)
+			}
+			continue
+		case "error-resilient":
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return EncoderConfig{}, fmt.Errorf("invalid value for %s: %v", name, err)
+			}
+			cfg.ErrorResilient = v
+			continue
+		}
+
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return EncoderConfig{}, fmt.Errorf("invalid value for %s: %v", name, err)
+		}
+		switch name {
+		case "bitrate":
+			cfg.TargetBitrate = v
+		case "min-q":
+			cfg.MinQuantizer = v
+		case "max-q":
+			cfg.MaxQuantizer = v
+		case "keyframe-interval":
+			cfg.KeyframeInterval = v
+		case "cpu-used":
+			cfg.CPUUsed = v
+		case "threads":
+			cfg.Threads = v
+		default:
+			return EncoderConfig{}, fmt.Errorf("unknown encoder setting %q", name)
+		}
+	}
+
+	return cfg, nil
+}
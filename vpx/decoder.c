@@ -7,8 +7,21 @@
 #include "vpx/vp8dx.h"
 #include "vpx/vpx_decoder.h"
 
-int vpx_init_dec(vpx_codec_ctx_t *ctx) {
-  vpx_codec_iface_t *interface = vpx_codec_vp8_dx();
+#include "decoder.h"
+
+int vpx_init_dec(vpx_codec_ctx_t *ctx, int codec) {
+  // codec matches Codec in config.go
+  vpx_codec_iface_t *interface;
+  switch (codec) {
+  case 0:
+    interface = vpx_codec_vp8_dx();
+    break;
+  case 1:
+    interface = vpx_codec_vp9_dx();
+    break;
+  default:
+    return VPX_CODEC_INVALID_PARAM;
+  }
 
   // Initialize codec
   int flags = 0;
@@ -21,7 +34,9 @@ int vpx_init_dec(vpx_codec_ctx_t *ctx) {
 }
 
 int vpx_decode(vpx_codec_ctx_t *ctx, const char *frame, int frame_len,
-               char *yv12_frame, int yv12_cap, int *yv12_len) {
+               vpx_dec_frame *out, int *got_frame) {
+  *got_frame = 0;
+
   // Decode the frame
   vpx_codec_err_t err =
       vpx_codec_decode(ctx, (const unsigned char *)frame, frame_len, NULL, 0);
@@ -29,25 +44,28 @@ int vpx_decode(vpx_codec_ctx_t *ctx, const char *frame, int frame_len,
     return err;
   }
 
-  // Write decoded data to yv12_frame
+  // A packet can hold more than one frame, but only the last is shown
   vpx_codec_iter_t iter = NULL;
-  vpx_image_t *img;
-
+  vpx_image_t *img, *last = NULL;
   while ((img = vpx_codec_get_frame(ctx, &iter))) {
-    for (int plane = 0; plane < 3; plane++) {
-      unsigned char *buf = img->planes[plane];
-      for (int y = 0; y < (plane ? (img->d_h + 1) >> 1 : img->d_h); y++) {
-        if (*yv12_len > yv12_cap) {
-          return VPX_CODEC_MEM_ERROR;
-        }
-
-        int len = (plane ? (img->d_w + 1) >> 1 : img->d_w);
-        memcpy(yv12_frame + *yv12_len, buf, len);
-        buf += img->stride[plane];
-        *yv12_len += len;
-      }
-    }
+    last = img;
+  }
+  if (!last) {
+    return 0;
+  }
+
+  // VP9 profiles 1 and up can have other chroma layouts or bit depths
+  if (last->fmt != VPX_IMG_FMT_I420) {
+    return VPX_CODEC_UNSUP_BITSTREAM;
+  }
+
+  out->width = last->d_w;
+  out->height = last->d_h;
+  for (int plane = 0; plane < 3; plane++) {
+    out->planes[plane] = last->planes[plane];
+    out->stride[plane] = last->stride[plane];
   }
+  *got_frame = 1;
 
   return 0;
 }
@@ -4,9 +4,10 @@ package vpx
 #cgo pkg-config: --static vpx
 
 #include "vpx/vpx_decoder.h"
+#include "decoder.h"
 
-int vpx_init_dec(vpx_codec_ctx_t *ctx);
-int vpx_decode(vpx_codec_ctx_t *ctx, const char* frame, int frame_len, char* yv12_frame, int yv12_len, int *decoded_len);
+int vpx_init_dec(vpx_codec_ctx_t *ctx, int codec);
+int vpx_decode(vpx_codec_ctx_t *ctx, const char* frame, int frame_len, vpx_dec_frame *out, int *got_frame);
 int vpx_cleanup_dec(vpx_codec_ctx_t *ctx);
 */
 import "C"
@@ -14,29 +15,20 @@ import (
 	"image"
 	"sync"
 	"unsafe"
-
-	"github.com/dialup-inc/ascii/yuv"
 )
 
 type Decoder struct {
 	mu sync.Mutex
 
-	width  int
-	height int
-	buf    []byte
-
 	ctx C.vpx_codec_ctx_t
 }
 
-func NewDecoder(width, height int) (*Decoder, error) {
-	d := &Decoder{
-		width:  width,
-		height: height,
-		
-		// PERF(maxhawkins): is this buffer too big?
-		buf: make([]byte, width*height*4),
-	}
-	ret := C.vpx_init_dec(&d.ctx)
+// NewDecoder creates a decoder for video in the given codec. Frames come
+// out at whatever size the stream is, which can change from frame to
+// frame.
+func NewDecoder(codec Codec) (*Decoder, error) {
+	d := &Decoder{}
+	ret := C.vpx_init_dec(&d.ctx, C.int(codec))
 	if ret != 0 {
 		return nil, VPXCodecErr(ret)
 	}
@@ -54,6 +46,8 @@ func (d *Decoder) Close() error {
 	return nil
 }
 
+// Decode decodes a frame. It returns nil if the frame doesn't produce a
+// picture to show.
 func (d *Decoder) Decode(b []byte) (image.Image, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -62,27 +56,34 @@ func (d *Decoder) Decode(b []byte) (image.Image, error) {
 		return nil, nil
 	}
 
-	n, err := d.decode(d.buf, b)
-	if err != nil {
-		return nil, err
-	}
-	frame := d.buf[:n]
+	inP := (*C.char)(unsafe.Pointer(&b[0]))
+	inL := C.int(len(b))
 
-	return yuv.FromI420(frame, d.width, d.height)
-}
+	var frame C.vpx_dec_frame
+	var gotFrame C.int
+	ret := C.vpx_decode(&d.ctx, inP, inL, &frame, &gotFrame)
+	if ret != 0 {
+		return nil, VPXCodecErr(ret)
+	}
+	if gotFrame == 0 {
+		return nil, nil
+	}
 
-func (d *Decoder) decode(out, in []byte) (n int, err error) {
-	inP := (*C.char)(unsafe.Pointer(&in[0]))
-	inL := C.int(len(in))
+	// The decoder's planes are padded out past the picture and reused for
+	// the next frame, so copy the visible part into a new image
+	width, height := int(frame.width), int(frame.height)
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	copyPlane(img.Y, img.YStride, height, frame.planes[0], int(frame.stride[0]))
+	copyPlane(img.Cb, img.CStride, (height+1)/2, frame.planes[1], int(frame.stride[1]))
+	copyPlane(img.Cr, img.CStride, (height+1)/2, frame.planes[2], int(frame.stride[2]))
 
-	outP := (*C.char)(unsafe.Pointer(&out[0]))
-	outCap := C.int(cap(out))
-	outL := (*C.int)(unsafe.Pointer(&n))
+	return img, nil
+}
 
-	ret := C.vpx_decode(&d.ctx, inP, inL, outP, outCap, outL)
-	if ret != 0 {
-		return n, VPXCodecErr(ret)
+// copyPlane copies rows of a plane from C memory with a different stride
+func copyPlane(dst []byte, dstStride, rows int, src *C.uchar, srcStride int) {
+	for y := 0; y < rows; y++ {
+		row := (*[1 << 30]byte)(unsafe.Pointer(uintptr(unsafe.Pointer(src)) + uintptr(y*srcStride)))[:dstStride:dstStride]
+		copy(dst[y*dstStride:], row)
 	}
-
-	return n, nil
 }
@@ -0,0 +1,13 @@
+#ifndef VPX_DECODER_FRAME_H
+#define VPX_DECODER_FRAME_H
+
+// vpx_dec_frame describes a decoded I420 picture. The planes point into
+// the decoder's memory and are only valid until the next decode.
+typedef struct {
+  int width;
+  int height;
+  unsigned char *planes[3];
+  int stride[3];
+} vpx_dec_frame;
+
+#endif
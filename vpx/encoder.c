@@ -6,49 +6,129 @@
 #include <vpx/vp8cx.h>
 #include <vpx/vpx_encoder.h>
 
-int vpx_init_enc(vpx_codec_ctx_t *codec, vpx_image_t **raw, int width,
-                 int height) {
-  vpx_codec_iface_t *interface = vpx_codec_vp8_cx();
+#include "encoder.h"
+
+int vpx_init_enc(vpx_codec_ctx_t *codec, vpx_image_t **raw,
+                 vpx_codec_enc_cfg_t **config, int width, int height,
+                 const vpx_enc_settings *settings) {
+  vpx_codec_iface_t *interface;
+  switch (settings->codec) {
+  case VPX_ENC_VP8:
+    interface = vpx_codec_vp8_cx();
+    break;
+  case VPX_ENC_VP9:
+    interface = vpx_codec_vp9_cx();
+    break;
+  default:
+    return VPX_CODEC_INVALID_PARAM;
+  }
 
   vpx_image_t *img = vpx_img_alloc(NULL, VPX_IMG_FMT_I420, width, height, 1);
   if (!img) {
     return VPX_CODEC_MEM_ERROR;
   }
-  *raw = img;
 
-  vpx_codec_enc_cfg_t cfg;
+  // The configuration is kept so it can be changed while encoding
+  vpx_codec_enc_cfg_t *cfg = malloc(sizeof(vpx_codec_enc_cfg_t));
+  if (!cfg) {
+    vpx_img_free(img);
+    return VPX_CODEC_MEM_ERROR;
+  }
 
   // Populate encoder configuration
-  vpx_codec_err_t err = vpx_codec_enc_config_default(interface, &cfg, 0);
+  vpx_codec_err_t err = vpx_codec_enc_config_default(interface, cfg, 0);
   if (err) {
-    return err;
+    goto fail;
   }
 
   // Update the default configuration with our settings
-  cfg.rc_target_bitrate =
-      width * height * cfg.rc_target_bitrate / cfg.g_w / cfg.g_h;
-  cfg.g_w = width;
-  cfg.g_h = height;
-  cfg.g_lag_in_frames = 0;
-  cfg.g_pass = VPX_RC_ONE_PASS;
-  cfg.rc_end_usage = VPX_CBR;
-  cfg.kf_mode = VPX_KF_AUTO;
-  cfg.kf_max_dist = 1000;
-  cfg.g_error_resilient =
-      VPX_ERROR_RESILIENT_DEFAULT | VPX_ERROR_RESILIENT_PARTITIONS;
-
-  // Initialize codec
-  err = vpx_codec_enc_init(codec, interface, &cfg, 0);
+  cfg->rc_target_bitrate = settings->target_bitrate;
+  cfg->rc_min_quantizer = settings->min_quantizer;
+  cfg->rc_max_quantizer = settings->max_quantizer;
+  cfg->g_threads = settings->threads;
+  cfg->g_w = width;
+  cfg->g_h = height;
+  // Timestamps are in milliseconds of wall-clock time
+  cfg->g_timebase.num = 1;
+  cfg->g_timebase.den = 1000;
+  cfg->g_lag_in_frames = 0;
+  cfg->g_pass = VPX_RC_ONE_PASS;
+  cfg->rc_end_usage = (enum vpx_rc_mode)settings->end_usage;
+  cfg->kf_mode = VPX_KF_AUTO;
+  cfg->kf_max_dist = settings->kf_max_dist;
+  cfg->g_error_resilient = 0;
+  if (settings->error_resilient) {
+    cfg->g_error_resilient =
+        VPX_ERROR_RESILIENT_DEFAULT | VPX_ERROR_RESILIENT_PARTITIONS;
+  }
+
+  // Initialize codec. This checks the configuration and returns
+  // VPX_CODEC_INVALID_PARAM if it's out of range.
+  err = vpx_codec_enc_init(codec, interface, cfg, 0);
   if (err) {
+    goto fail;
+  }
+
+  err = vpx_codec_control(codec, VP8E_SET_CPUUSED, settings->cpu_used);
+  if (err) {
+    vpx_codec_destroy(codec);
+    goto fail;
+  }
+
+  *raw = img;
+  *config = cfg;
+  return 0;
+
+fail:
+  free(cfg);
+  vpx_img_free(img);
+  return err;
+}
+
+int vpx_set_bitrate(vpx_codec_ctx_t *codec, vpx_codec_enc_cfg_t *cfg,
+                    int bitrate) {
+  unsigned int old = cfg->rc_target_bitrate;
+
+  cfg->rc_target_bitrate = bitrate;
+  vpx_codec_err_t err = vpx_codec_enc_config_set(codec, cfg);
+  if (err) {
+    cfg->rc_target_bitrate = old;
+    return err;
+  }
+
+  return 0;
+}
+
+int vpx_set_resolution(vpx_codec_ctx_t *codec, vpx_codec_enc_cfg_t *cfg,
+                       vpx_image_t **raw, int width, int height) {
+  vpx_image_t *img = vpx_img_alloc(NULL, VPX_IMG_FMT_I420, width, height, 1);
+  if (!img) {
+    return VPX_CODEC_MEM_ERROR;
+  }
+
+  unsigned int old_w = cfg->g_w;
+  unsigned int old_h = cfg->g_h;
+
+  // VP8 can only shrink from the size it was created with. Growing past
+  // that returns VPX_CODEC_INVALID_PARAM.
+  cfg->g_w = width;
+  cfg->g_h = height;
+  vpx_codec_err_t err = vpx_codec_enc_config_set(codec, cfg);
+  if (err) {
+    cfg->g_w = old_w;
+    cfg->g_h = old_h;
+    vpx_img_free(img);
     return err;
   }
 
+  vpx_img_free(*raw);
+  *raw = img;
   return 0;
 }
 
 int vpx_encode(vpx_codec_ctx_t *ctx, vpx_image_t *raw, const char *yv12_frame,
                int yv12_len, char *encoded, int encoded_cap, int *encoded_len,
-               int pts, int force_key_frame) {
+               int pts, int force_key_frame, unsigned long deadline) {
   *encoded_len = 0;
 
   int flags = 0;
@@ -60,8 +140,10 @@ int vpx_encode(vpx_codec_ctx_t *ctx, vpx_image_t *raw, const char *yv12_frame,
   // raw->planes[0] = (unsigned char *)yv12_frame;
   memcpy(raw->planes[0], yv12_frame, yv12_len);
 
+  // Frames aren't evenly spaced, but rate control measures each one from
+  // the end of the previous frame so a nominal duration is enough
   vpx_codec_err_t err =
-      vpx_codec_encode(ctx, raw, pts, 1, flags, VPX_DL_REALTIME);
+      vpx_codec_encode(ctx, raw, pts, 1, flags, deadline);
   if (err) {
     return err;
   }
@@ -88,8 +170,10 @@ int vpx_encode(vpx_codec_ctx_t *ctx, vpx_image_t *raw, const char *yv12_frame,
   return 0;
 }
 
-int vpx_cleanup_enc(vpx_codec_ctx_t *codec, vpx_image_t *raw) {
+int vpx_cleanup_enc(vpx_codec_ctx_t *codec, vpx_image_t *raw,
+                    vpx_codec_enc_cfg_t *cfg) {
   vpx_img_free(raw);
+  free(cfg);
 
   vpx_codec_err_t err = vpx_codec_destroy(codec);
   if (err) {
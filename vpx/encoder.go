@@ -4,14 +4,18 @@ package vpx
 #cgo pkg-config: --static vpx
 
 #include "vpx/vpx_encoder.h"
+#include "encoder.h"
 
-int vpx_init_enc(vpx_codec_ctx_t *ctx, vpx_image_t **raw, int width, int height);
-int vpx_encode(vpx_codec_ctx_t *ctx, vpx_image_t *raw, const char* yv12_frame, int yv12_len, char* encoded, int encoded_cap, int* size, int pts, int force_key_frame);
-int vpx_cleanup_enc(vpx_codec_ctx_t *ctx, vpx_image_t *raw);
+int vpx_init_enc(vpx_codec_ctx_t *ctx, vpx_image_t **raw, vpx_codec_enc_cfg_t **cfg, int width, int height, const vpx_enc_settings *settings);
+int vpx_set_bitrate(vpx_codec_ctx_t *ctx, vpx_codec_enc_cfg_t *cfg, int bitrate);
+int vpx_set_resolution(vpx_codec_ctx_t *ctx, vpx_codec_enc_cfg_t *cfg, vpx_image_t **raw, int width, int height);
+int vpx_encode(vpx_codec_ctx_t *ctx, vpx_image_t *raw, const char* yv12_frame, int yv12_len, char* encoded, int encoded_cap, int* size, int pts, int force_key_frame, unsigned long deadline);
+int vpx_cleanup_enc(vpx_codec_ctx_t *ctx, vpx_image_t *raw, vpx_codec_enc_cfg_t *cfg);
 */
 import "C"
 
 import (
+	"errors"
 	"image"
 	"sync"
 	"unsafe"
@@ -24,33 +28,160 @@ type Encoder struct {
 
 	ctx C.vpx_codec_ctx_t
 	img *C.vpx_image_t
+	cfg *C.vpx_codec_enc_cfg_t
+
+	// config and the size are kept up to date so the encoder can be
+	// recreated when libvpx can't change it in place
+	config        EncoderConfig
+	width, height int
+
+	// closed is set once the libvpx context is gone, either by Close or
+	// because SetResolution couldn't start it again
+	closed bool
 }
 
-func NewEncoder(width, height int) (*Encoder, error) {
+var errClosed = errors.New("encoder is closed")
+
+// NewEncoder creates an encoder for frames of the given size. Settings
+// libvpx rejects are returned as VPX_CODEC_INVALID_PARAM.
+func NewEncoder(width, height int, cfg EncoderConfig) (*Encoder, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
 	e := &Encoder{}
-	ret := C.vpx_init_enc(&e.ctx, &e.img, C.int(width), C.int(height))
-	if ret != 0 {
-		return nil, VPXCodecErr(ret)
+	if err := e.init(width, height, cfg); err != nil {
+		return nil, err
 	}
 	return e, nil
 }
 
+func (e *Encoder) init(width, height int, cfg EncoderConfig) error {
+	cpuUsed := cfg.CPUUsed
+	if cpuUsed == 0 && cfg.Codec == VP9 {
+		cpuUsed = vp9DefaultCPUUsed
+	}
+
+	settings := C.vpx_enc_settings{
+		codec:          C.int(cfg.Codec),
+		target_bitrate: C.int(cfg.TargetBitrate),
+		min_quantizer:  C.int(cfg.MinQuantizer),
+		max_quantizer:  C.int(cfg.MaxQuantizer),
+		kf_max_dist:    C.int(cfg.KeyframeInterval),
+		cpu_used:       C.int(cpuUsed),
+		threads:        C.int(cfg.Threads),
+		end_usage:      C.int(cfg.EndUsage),
+	}
+	if cfg.ErrorResilient {
+		settings.error_resilient = 1
+	}
+
+	ret := C.vpx_init_enc(&e.ctx, &e.img, &e.cfg, C.int(width), C.int(height), &settings)
+	if ret != 0 {
+		return VPXCodecErr(ret)
+	}
+
+	e.config = cfg
+	e.width, e.height = width, height
+	return nil
+}
+
 func (e *Encoder) Close() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	ret := C.vpx_cleanup_enc(&e.ctx, e.img)
+	if e.closed {
+		return errClosed
+	}
+	e.closed = true
+
+	ret := C.vpx_cleanup_enc(&e.ctx, e.img, e.cfg)
+	e.img, e.cfg = nil, nil
 	if ret != 0 {
 		return VPXCodecErr(ret)
 	}
 	return nil
 }
 
+// SetBitrate changes the target bitrate, in kilobits per second, starting
+// with the next frame
+func (e *Encoder) SetBitrate(kbps int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return errClosed
+	}
+	if kbps <= 0 {
+		return VPX_CODEC_INVALID_PARAM
+	}
+
+	ret := C.vpx_set_bitrate(&e.ctx, e.cfg, C.int(kbps))
+	if ret != 0 {
+		return VPXCodecErr(ret)
+	}
+	e.config.TargetBitrate = kbps
+	return nil
+}
+
+// SetResolution changes the size of the frames passed to Encode. VP8 can
+// only shrink in place, so growing restarts the encoder, which makes the
+// next frame a keyframe.
+func (e *Encoder) SetResolution(width, height int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return errClosed
+	}
+	if width <= 0 || height <= 0 {
+		return VPX_CODEC_INVALID_PARAM
+	}
+	if width == e.width && height == e.height {
+		return nil
+	}
+
+	ret := C.vpx_set_resolution(&e.ctx, e.cfg, &e.img, C.int(width), C.int(height))
+	if ret == 0 {
+		e.width, e.height = width, height
+		return nil
+	}
+	if VPXCodecErr(ret) != VPX_CODEC_INVALID_PARAM {
+		return VPXCodecErr(ret)
+	}
+
+	// The image and config are freed even if cleanup fails, so from here
+	// on the encoder is unusable until init succeeds
+	ret = C.vpx_cleanup_enc(&e.ctx, e.img, e.cfg)
+	e.img, e.cfg = nil, nil
+	if ret != 0 {
+		e.closed = true
+		return VPXCodecErr(ret)
+	}
+	if err := e.init(width, height, e.config); err != nil {
+		// Go back to the old size so the encoder still works
+		if initErr := e.init(e.width, e.height, e.config); initErr != nil {
+			e.closed = true
+			return initErr
+		}
+		return err
+	}
+	return nil
+}
+
 func (e *Encoder) Encode(vpxFrame []byte, img image.Image, pts int, forceKeyframe bool) (n int, err error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	i420, _, _ := yuv.ToI420(img)
+	if e.closed {
+		return 0, errClosed
+	}
+
+	i420, width, height := yuv.ToI420(img)
+	if width != e.width || height != e.height {
+		// The encoder's buffer is only big enough for its own size
+		return 0, VPX_CODEC_INVALID_PARAM
+	}
 	return e.encode(vpxFrame, i420, pts, forceKeyframe)
 }
 
@@ -67,7 +198,7 @@ func (e *Encoder) encode(vpxFrame, yuvFrame []byte, pts int, forceKeyframe bool)
 		forceKeyframeB = C.int(1)
 	}
 
-	ret := C.vpx_encode(&e.ctx, e.img, inP, inL, outP, outCap, outL, C.int(pts), forceKeyframeB)
+	ret := C.vpx_encode(&e.ctx, e.img, inP, inL, outP, outCap, outL, C.int(pts), forceKeyframeB, C.ulong(e.config.Deadline))
 	if ret != 0 {
 		return n, VPXCodecErr(ret)
 	}
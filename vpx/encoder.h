@@ -0,0 +1,21 @@
+#ifndef VPX_ENCODER_SETTINGS_H
+#define VPX_ENCODER_SETTINGS_H
+
+// Codecs, matching Codec in config.go
+#define VPX_ENC_VP8 0
+#define VPX_ENC_VP9 1
+
+// vpx_enc_settings mirrors EncoderConfig in config.go
+typedef struct {
+  int codec;
+  int target_bitrate;
+  int min_quantizer;
+  int max_quantizer;
+  int kf_max_dist;
+  int cpu_used;
+  int threads;
+  int error_resilient;
+  int end_usage;
+} vpx_enc_settings;
+
+#endif
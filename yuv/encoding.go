@@ -57,6 +57,73 @@ func FromNV21(frame []byte, width, height int) (*image.YCbCr, error) {
 	}, nil
 }
 
+// FromNV12 decodes an NV12-encoded YUV image into a Go Image. NV12 has a
+// full size Y plane followed by a plane of interleaved Cb and Cr samples.
+//
+// See https://www.fourcc.org/pixel-format/yuv-nv12/
+func FromNV12(frame []byte, width, height int) (*image.YCbCr, error) {
+	// Odd sizes round up, so the last column and row have chroma too
+	chromaWidth, chromaHeight := (width+1)/2, (height+1)/2
+
+	yi := width * height
+	ci := yi + 2*chromaWidth*chromaHeight
+
+	if ci > len(frame) {
+		return nil, fmt.Errorf("frame length (%d) less than expected (%d)", len(frame), ci)
+	}
+
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	copy(img.Y, frame[:yi])
+
+	for j := range img.Cb {
+		img.Cb[j] = frame[yi+2*j]
+		img.Cr[j] = frame[yi+2*j+1]
+	}
+
+	return img, nil
+}
+
+// FromYUYV decodes a packed YUYV 4:2:2 image into a 4:2:0 Go Image, which
+// can be encoded without converting through RGB. Each pair of pixels is
+// stored as Y0 Cb Y1 Cr, and the chroma of each pair of rows is averaged.
+//
+// See https://www.fourcc.org/pixel-format/yuv-yuy2/
+func FromYUYV(frame []byte, width, height int) (*image.YCbCr, error) {
+	if width%2 != 0 {
+		return nil, fmt.Errorf("YUYV width (%d) must be even", width)
+	}
+
+	stride := width * 2
+	if stride*height > len(frame) {
+		return nil, fmt.Errorf("frame length (%d) less than expected (%d)", len(frame), stride*height)
+	}
+
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+
+	for y := 0; y < height; y++ {
+		row := frame[y*stride : (y+1)*stride]
+		for x := 0; x < width; x++ {
+			img.Y[y*img.YStride+x] = row[x*2]
+		}
+	}
+
+	for y := 0; y < height; y += 2 {
+		top := frame[y*stride : (y+1)*stride]
+		bottom := top
+		if y+1 < height {
+			bottom = frame[(y+1)*stride : (y+2)*stride]
+		}
+
+		for x := 0; x < width/2; x++ {
+			ci := (y/2)*img.CStride + x
+			img.Cb[ci] = uint8((int(top[x*4+1]) + int(bottom[x*4+1]) + 1) / 2)
+			img.Cr[ci] = uint8((int(top[x*4+3]) + int(bottom[x*4+3]) + 1) / 2)
+		}
+	}
+
+	return img, nil
+}
+
 func convertTo420(img image.Image) *image.YCbCr {
 	bounds := img.Bounds()
 	img420 := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420)
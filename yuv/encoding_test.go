@@ -0,0 +1,136 @@
+package yuv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFromNV12(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		frame         []byte
+		y, cb, cr     []byte
+	}{
+		{
+			name:  "4x2",
+			width: 4, height: 2,
+			frame: []byte{
+				0, 1, 2, 3,
+				4, 5, 6, 7,
+				10, 20, 11, 21,
+			},
+			y:  []byte{0, 1, 2, 3, 4, 5, 6, 7},
+			cb: []byte{10, 11},
+			cr: []byte{20, 21},
+		},
+		{
+			// The odd column and row still get a chroma sample each
+			name:  "3x3",
+			width: 3, height: 3,
+			frame: []byte{
+				0, 1, 2,
+				3, 4, 5,
+				6, 7, 8,
+				10, 20, 11, 21,
+				12, 22, 13, 23,
+			},
+			y:  []byte{0, 1, 2, 3, 4, 5, 6, 7, 8},
+			cb: []byte{10, 11, 12, 13},
+			cr: []byte{20, 21, 22, 23},
+		},
+	}
+
+	for _, tt := range tests {
+		img, err := FromNV12(tt.frame, tt.width, tt.height)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Errorf("%s: image is %dx%d", tt.name, b.Dx(), b.Dy())
+		}
+		if !bytes.Equal(img.Y, tt.y) {
+			t.Errorf("%s: Y = %v, want %v", tt.name, img.Y, tt.y)
+		}
+		if !bytes.Equal(img.Cb, tt.cb) {
+			t.Errorf("%s: Cb = %v, want %v", tt.name, img.Cb, tt.cb)
+		}
+		if !bytes.Equal(img.Cr, tt.cr) {
+			t.Errorf("%s: Cr = %v, want %v", tt.name, img.Cr, tt.cr)
+		}
+
+		// The bottom right pixel uses the last chroma sample
+		c := img.YCbCrAt(tt.width-1, tt.height-1)
+		last := len(tt.cb) - 1
+		if c.Y != tt.y[len(tt.y)-1] || c.Cb != tt.cb[last] || c.Cr != tt.cr[last] {
+			t.Errorf("%s: bottom right is %v", tt.name, c)
+		}
+	}
+
+	if _, err := FromNV12(make([]byte, 15), 3, 3); err == nil {
+		t.Error("short frame decoded without an error")
+	}
+}
+
+func TestFromYUYV(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		frame         []byte
+		y, cb, cr     []byte
+	}{
+		{
+			// Chroma is averaged over each pair of rows
+			name:  "4x2",
+			width: 4, height: 2,
+			frame: []byte{
+				0, 10, 1, 20, 2, 30, 3, 40,
+				4, 12, 5, 22, 6, 33, 7, 43,
+			},
+			y:  []byte{0, 1, 2, 3, 4, 5, 6, 7},
+			cb: []byte{11, 32},
+			cr: []byte{21, 42},
+		},
+		{
+			// The last row has no partner, so its chroma is used as is
+			name:  "2x3",
+			width: 2, height: 3,
+			frame: []byte{
+				0, 10, 1, 20,
+				2, 10, 3, 20,
+				4, 50, 5, 60,
+			},
+			y:  []byte{0, 1, 2, 3, 4, 5},
+			cb: []byte{10, 50},
+			cr: []byte{20, 60},
+		},
+	}
+
+	for _, tt := range tests {
+		img, err := FromYUYV(tt.frame, tt.width, tt.height)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Errorf("%s: image is %dx%d", tt.name, b.Dx(), b.Dy())
+		}
+		if !bytes.Equal(img.Y, tt.y) {
+			t.Errorf("%s: Y = %v, want %v", tt.name, img.Y, tt.y)
+		}
+		if !bytes.Equal(img.Cb, tt.cb) {
+			t.Errorf("%s: Cb = %v, want %v", tt.name, img.Cb, tt.cb)
+		}
+		if !bytes.Equal(img.Cr, tt.cr) {
+			t.Errorf("%s: Cr = %v, want %v", tt.name, img.Cr, tt.cr)
+		}
+	}
+
+	if _, err := FromYUYV(make([]byte, 6*2), 3, 2); err == nil {
+		t.Error("odd width decoded without an error")
+	}
+	if _, err := FromYUYV(make([]byte, 8*2-1), 4, 2); err == nil {
+		t.Error("short frame decoded without an error")
+	}
+}